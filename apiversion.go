@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Clients can pin the shape of API responses with "Accept: application/vnd.chirpy.v1+json".
+// Without a version they get the current one, as plain application/json. Handlers that need to
+// answer differently in a later version check apiVersionFromContext.
+const (
+	apiVersion1       = 1
+	currentAPIVersion = apiVersion1
+)
+
+const apiVersionKey contextKey = "apiVersion"
+
+// supportedAPIVersions is every version a client can still ask for
+var supportedAPIVersions = map[int]bool{
+	apiVersion1: true,
+}
+
+// apiVersionMediaType is the vendor media type for version, e.g. application/vnd.chirpy.v1+json
+func apiVersionMediaType(version int) string {
+	return "application/vnd.chirpy.v" + strconv.Itoa(version) + "+json"
+}
+
+// requestedAPIVersion finds a vnd.chirpy version in an Accept header ("application/vnd.chirpy.v2+json, */*").
+// ok is false if there isn't one, in which case the client gets the current version.
+func requestedAPIVersion(accept string) (version int, ok bool, err error) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue // something else's problem; the rest of the header may still be fine
+		}
+		versionString, isChirpy := strings.CutPrefix(mediaType, "application/vnd.chirpy.v")
+		if !isChirpy {
+			continue
+		}
+		versionString, isJSON := strings.CutSuffix(versionString, "+json")
+		version, err := strconv.Atoi(versionString)
+		if !isJSON || err != nil || version < 1 {
+			return 0, false, fmt.Errorf("can't parse API version from %q", mediaType)
+		}
+		return version, true, nil
+	}
+	return 0, false, nil
+}
+
+// middlewareAPIVersion works out which API version an /api/ request wants and stores it in the context,
+// answering 406 if it's one we don't (or no longer) support. When a version was asked for by name,
+// JSON responses come back labelled with that same media type.
+//
+// It has to go outside metrics.middleware: it passes a new *http.Request down, and the mux
+// has to be handed the one the metrics middleware holds.
+func middlewareAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept") // the same URL can answer differently depending on the version asked for
+
+		version, ok, err := requestedAPIVersion(r.Header.Get("Accept"))
+		if err != nil || (ok && !supportedAPIVersions[version]) {
+			respondWithError(w, 406, errCodeUnsupportedVersion, fmt.Sprintf("unsupported API version; ask for %s or leave it out", apiVersionMediaType(currentAPIVersion)))
+			return
+		}
+		if !ok {
+			version = currentAPIVersion
+		} else {
+			w = &versionedWriter{ResponseWriter: w, mediaType: apiVersionMediaType(version)}
+		}
+
+		ctx := context.WithValue(r.Context(), apiVersionKey, version)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiVersionFromContext is the version set by middlewareAPIVersion (the current one if it didn't run)
+func apiVersionFromContext(ctx context.Context) int {
+	version, ok := ctx.Value(apiVersionKey).(int)
+	if !ok {
+		return currentAPIVersion
+	}
+	return version
+}
+
+// versionedWriter relabels application/json responses (everything jsonWriter sends) with the
+// versioned media type the client asked for.
+type versionedWriter struct {
+	http.ResponseWriter
+	mediaType   string
+	wroteHeader bool
+}
+
+func (v *versionedWriter) WriteHeader(code int) {
+	if !v.wroteHeader && v.Header().Get("Content-Type") == "application/json" {
+		v.Header().Set("Content-Type", v.mediaType)
+	}
+	v.wroteHeader = true
+	v.ResponseWriter.WriteHeader(code)
+}
+
+func (v *versionedWriter) Write(b []byte) (int, error) {
+	if !v.wroteHeader {
+		v.WriteHeader(http.StatusOK)
+	}
+	return v.ResponseWriter.Write(b)
+}
+
+// Hijack passes through to the real ResponseWriter, so WebSocket upgrades (GET /api/ws) still work.
+func (v *versionedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := v.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Flush passes through as well, for streamed responses (GET /api/chirps/export)
+func (v *versionedWriter) Flush() {
+	if !v.wroteHeader {
+		v.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := v.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestedAPIVersion(t *testing.T) {
+	cases := []struct {
+		accept      string
+		wantVersion int
+		wantOK      bool
+		wantErr     bool
+	}{
+		{"", 0, false, false},
+		{"application/json", 0, false, false},
+		{"*/*", 0, false, false},
+		{"application/vnd.chirpy.v1+json", 1, true, false},
+		{"application/vnd.chirpy.v2+json; charset=utf-8", 2, true, false},
+		{"text/html, application/vnd.chirpy.v1+json;q=0.9, */*;q=0.1", 1, true, false},
+		{"application/VND.Chirpy.v1+JSON", 1, true, false}, // media types are case-insensitive
+		{"application/vnd.chirpy.vlatest+json", 0, false, true},
+		{"application/vnd.chirpy.v0+json", 0, false, true},
+		{"application/vnd.chirpy.v1+xml", 0, false, true},
+	}
+
+	for _, c := range cases {
+		version, ok, err := requestedAPIVersion(c.accept)
+		if version != c.wantVersion || ok != c.wantOK || (err != nil) != c.wantErr {
+			t.Errorf("%q: expected %v %v (error: %v), got: %v %v %v", c.accept, c.wantVersion, c.wantOK, c.wantErr, version, ok, err)
+		}
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	server := newTestServer(newTestConfig(newMockDB()))
+	defer server.Close()
+
+	get := func(path, accept string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error sending request: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	cases := []struct {
+		accept          string
+		wantStatus      int
+		wantContentType string
+	}{
+		{"", 200, "application/json"}, // no version: the current one, as plain JSON
+		{"application/json", 200, "application/json"},
+		{"application/vnd.chirpy.v1+json", 200, "application/vnd.chirpy.v1+json"},
+		{"application/vnd.chirpy.v99+json", 406, "application/json"},
+		{"application/vnd.chirpy.vnext+json", 406, "application/json"},
+	}
+	for _, c := range cases {
+		resp := get("/api/chirps", c.accept)
+		if resp.StatusCode != c.wantStatus {
+			t.Errorf("%q: expected status: %v, got: %v", c.accept, c.wantStatus, resp.StatusCode)
+		}
+		if got := resp.Header.Get("Content-Type"); got != c.wantContentType {
+			t.Errorf("%q: expected Content-Type: %v, got: %v", c.accept, c.wantContentType, got)
+		}
+		if resp.Header.Get("Vary") != "Accept" {
+			t.Errorf("%q: expected Vary: Accept, got: %q", c.accept, resp.Header.Get("Vary"))
+		}
+	}
+
+	// errors are JSON too, so they get the versioned type
+	resp := get("/api/chirps/not-a-real-route/at-all", "application/vnd.chirpy.v1+json")
+	if resp.StatusCode != 404 || resp.Header.Get("Content-Type") != "application/vnd.chirpy.v1+json" {
+		t.Errorf("404: expected versioned JSON error, got: %v %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// only /api/ is versioned: /metrics turns away the missing key, not the version
+	resp = get("/metrics", "application/vnd.chirpy.v99+json")
+	if resp.StatusCode != 401 || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("/metrics: expected 401 as plain JSON, got: %v %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const maxChirpSearchLength = 100
+
+// chirpFilter is everything GET /api/chirps can narrow its list (or pages) down by, ready for the query
+type chirpFilter struct {
+	lang        sql.NullString // ?lang=en
+	authorID    uuid.NullUUID  // ?author_id=
+	bodyPattern sql.NullString // ?q=, as an ILIKE pattern
+	newestFirst bool           // ?sort=desc (asc is oldest first)
+}
+
+// isSet reports whether any filter was asked for (sort doesn't count, since it doesn't leave anything out)
+func (f chirpFilter) isSet() bool {
+	return f.lang.Valid || f.authorID.Valid || f.bodyPattern.Valid
+}
+
+// parseChirpFilter checks each filter param on its own, so the error says which one is wrong.
+// newestFirst is the order to use when there's no ?sort=.
+func parseChirpFilter(query url.Values, newestFirst bool) (chirpFilter, error) {
+	filter := chirpFilter{newestFirst: newestFirst}
+
+	lang, err := parseLang(query.Get("lang"))
+	if err != nil {
+		return chirpFilter{}, err
+	}
+	filter.lang = lang
+
+	if authorParam := query.Get("author_id"); authorParam != "" {
+		authorID, err := uuid.Parse(authorParam)
+		if err != nil {
+			return chirpFilter{}, errors.New("author_id must be a user id")
+		}
+		filter.authorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+
+	if query.Has("q") {
+		search := strings.TrimSpace(query.Get("q"))
+		if search == "" || utf8.RuneCountInString(search) > maxChirpSearchLength {
+			return chirpFilter{}, fmt.Errorf("q must be between 1 and %d characters", maxChirpSearchLength)
+		}
+		filter.bodyPattern = sql.NullString{String: "%" + escapeLike(search) + "%", Valid: true}
+	}
+
+	switch query.Get("sort") {
+	case "":
+	case "asc":
+		filter.newestFirst = false
+	case "desc":
+		filter.newestFirst = true
+	default:
+		return chirpFilter{}, errors.New(`sort must be "asc" or "desc"`)
+	}
+
+	return filter, nil
+}
+
+// likeEscaper makes text match itself literally in a LIKE pattern (backslash is Postgres' default escape)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies turns TRUSTED_PROXIES ("10.0.0.0/8,192.168.1.5,...") into prefixes.
+// A bare address means just that one host. Empty input means no proxies are trusted.
+func parseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// middlewareClientIP works out the real client address once per request (see resolveClientIP)
+// and stores it in the context for clientIP.
+func (cfg *apiConfig) middlewareClientIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := resolveClientIP(r, cfg.trustedProxies)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+	})
+}
+
+// clientIP returns the address of whoever actually sent the request, as found by middlewareClientIP.
+// Outside that middleware (e.g. in tests) it's just the host part of RemoteAddr.
+func clientIP(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteHost(req)
+}
+
+// resolveClientIP trusts X-Forwarded-For only as far as our own proxies wrote it. If the peer isn't a
+// trusted proxy the header is ignored (anyone can send one). Otherwise it walks the header from the
+// right - each proxy appends the address it got the request from - skipping trusted hops, and returns
+// the first one that isn't ours. Anything further left was written by the client, so can't be believed.
+func resolveClientIP(req *http.Request, trusted []netip.Prefix) string {
+	peer := remoteHost(req)
+	if !isTrustedProxy(peer, trusted) {
+		return peer
+	}
+
+	var hops []string
+	for _, header := range req.Header.Values("X-Forwarded-For") { // several proxies may each add their own header line
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break // garbage: stop at the last hop we could make sense of
+		}
+		client = addr.Unmap().String()
+		if !isTrustedProxy(client, trusted) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap() // ::ffff:10.0.0.1 is 10.0.0.1
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost is RemoteAddr without the port
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatalf("error parsing trusted proxies: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string // X-Forwarded-For header lines
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5555", nil, "203.0.113.7"},
+		{"direct client can't spoof", "203.0.113.7:5555", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"behind our proxy", "10.0.0.2:80", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed entry left of the real one", "10.0.0.2:80", []string{"1.2.3.4, 203.0.113.7"}, "203.0.113.7"},
+		{"two of our proxies", "10.0.0.2:80", []string{"203.0.113.7, 192.168.1.5"}, "203.0.113.7"},
+		{"one header line per proxy", "10.0.0.2:80", []string{"203.0.113.7", "10.1.1.1"}, "203.0.113.7"},
+		{"only our proxies", "10.0.0.2:80", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"trusted peer, no header", "10.0.0.2:80", nil, "10.0.0.2"},
+		{"garbage in the header", "10.0.0.2:80", []string{"nonsense"}, "10.0.0.2"},
+		{"ipv6 client", "[::ffff:10.0.0.2]:80", []string{"2001:db8::1"}, "2001:db8::1"},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/api/healthz", nil)
+		req.RemoteAddr = c.remoteAddr
+		for _, line := range c.forwarded {
+			req.Header.Add("X-Forwarded-For", line)
+		}
+		if got := resolveClientIP(req, trusted); got != c.want {
+			t.Errorf("%s: expected %v, got: %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := parseTrustedProxies("")
+	if err != nil || len(prefixes) != 0 {
+		t.Errorf("expected no proxies for empty input, got: %v (error %v)", prefixes, err)
+	}
+
+	for _, bad := range []string{"10.0.0.0/99", "not-an-ip", "10.0.0.1,,bogus/8"} {
+		if _, err := parseTrustedProxies(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envSecret reads a secret environment variable. If name+"_FILE" is set, it's the path of a file
+// holding the value instead (as container secrets and secret managers mount them), and it wins
+// over name itself. A trailing newline in the file is dropped, since most editors add one.
+func envSecret(name string) (string, error) {
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return os.Getenv(name), nil
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: can't read %s: %w", name, path, err)
+	}
+	value := strings.TrimRight(string(contents), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("%s_FILE: %s is empty", name, path)
+	}
+	return value, nil
+}
+
+// envBool reads a true/false environment variable, falling back to defaultValue when it's unset.
+func envBool(name string, defaultValue bool) (bool, error) {
+	valueString := os.Getenv(name)
+	if valueString == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.ParseBool(valueString)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got: %q", name, valueString)
+	}
+	return value, nil
+}
+
+// envNonNegativeInt reads a whole-number environment variable (0 allowed), falling back to defaultValue when it's unset.
+func envNonNegativeInt(name string, defaultValue int) (int, error) {
+	valueString := os.Getenv(name)
+	if valueString == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(valueString)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be zero or a positive integer, got: %q", name, valueString)
+	}
+	return value, nil
+}
+
+// envPositiveInt reads a positive integer environment variable, falling back to defaultValue when it's unset.
+func envPositiveInt(name string, defaultValue int) (int, error) {
+	valueString := os.Getenv(name)
+	if valueString == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(valueString)
+	if err != nil || value < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer, got: %q", name, valueString)
+	}
+	return value, nil
+}
+
+// envDuration reads a Go duration ("15m", "2h") up to maxValue, falling back to defaultValue when it's unset.
+func envDuration(name string, defaultValue, maxValue time.Duration) (time.Duration, error) {
+	valueString := os.Getenv(name)
+	if valueString == "" {
+		return defaultValue, nil
+	}
+	value, err := time.ParseDuration(valueString)
+	if err != nil || value <= 0 || value > maxValue {
+		return 0, fmt.Errorf("%s must be a duration between 0 and %v, got: %q", name, maxValue, valueString)
+	}
+	return value, nil
+}
+
+// configSummary is what main() logs once at startup, as slog key/value pairs, so you can check what a running
+// server actually picked up. Secrets are only ever reported as set or not: nothing here reads one beyond
+// that, so a new secret can't leak through it by accident. The database URL keeps just scheme, host and
+// database name, since the user, password and options all live in it too.
+func (cfg *apiConfig) configSummary(addr, dbURL string) []any {
+	return []any{
+		"addr", addr,
+		"platform", cfg.platform,
+		"version", version,
+		"database", redactDBURL(dbURL),
+		"jwt_configured", cfg.jwtKeys.Primary.Secret != "",
+		"jwt_key_id", cfg.jwtKeys.Primary.ID, // names the key, it isn't one
+		"jwt_previous_keys", len(cfg.jwtKeys.Previous),
+		"jwt_audience", cfg.audience,
+		"access_token_ttl", cfg.accessTokenTTL,
+		"introspection_api_key_set", cfg.introspectionAPIKey != "",
+		"admin_email", cfg.adminEmail,
+		"password_algo", cfg.passwordAlgorithm,
+		"check_breached_passwords", cfg.breachChecker != nil,
+		"filter_profanity", cfg.filterProfanity,
+		"profanity_style", cfg.profanityStyle,
+		"profanity_match", cfg.profanityMatch,
+		"banned_words", len(bannedWords()),
+		"max_chirp_length", cfg.maxChirpLength,
+		"chirp_dedupe_window", cfg.chirpDedupeWindow,
+		"db_timeout", cfg.dbTimeout,
+		"db_max_retries", cfg.dbRetry.maxRetries,
+		"db_max_open_conns", cfg.dbMaxOpenConns,
+		"auth_cookie_secure", cfg.authCookieSecure,
+		"trusted_proxies", len(cfg.trustedProxies),
+		"static_max_age", cfg.staticMaxAge,
+		"deactivation_grace", cfg.deactivationGrace,
+	}
+}
+
+// redactDBURL cuts a postgres:// URL down to what's safe to log. Anything else (a key=value DSN, say)
+// could have a password anywhere in it, so it's not shown at all.
+func redactDBURL(dbURL string) string {
+	if dbURL == "" {
+		return "not set"
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "set (not shown)"
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
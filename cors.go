@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// how long (in seconds) browsers may cache a preflight answer
+const corsMaxAge = 600
+
+// headers browsers may send cross-origin, beyond the always-allowed simple ones
+const corsAllowedHeaders = "Authorization, Content-Type, If-Modified-Since, If-None-Match, If-Unmodified-Since, X-Request-ID"
+
+// response headers browser scripts may read, beyond the always-readable simple ones
+const corsExposedHeaders = "X-Request-ID, X-Total-Count, Last-Modified, ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset"
+
+// corsPolicy says which other sites' pages may call a route from a browser
+type corsPolicy struct {
+	anyOrigin        bool     // any site at all; never sends cookies, so only for things that are public anyway
+	origins          []string // exact origins like "https://chirpy.example.com"
+	allowCredentials bool     // let the browser send the login cookie (only ever with origins, not anyOrigin)
+}
+
+func (p corsPolicy) allows(origin string) bool {
+	return p.anyOrigin || slices.Contains(p.origins, origin)
+}
+
+// corsRule applies policy to requests whose path is prefix or below it (by whole segments, so "/api/chirps"
+// covers "/api/chirps/123" but not "/api/chirpsfoo"). No methods means every method.
+type corsRule struct {
+	methods []string
+	prefix  string
+	policy  corsPolicy
+}
+
+func (rule corsRule) matches(method, path string) bool {
+	if len(rule.methods) > 0 && !slices.Contains(rule.methods, method) {
+		return false
+	}
+	return path == rule.prefix || strings.HasPrefix(path, strings.TrimSuffix(rule.prefix, "/")+"/")
+}
+
+// newCORSRules is the policy for this API: anyone can read public data, but everything else (logging in,
+// posting, admin) is only open to appOrigins - our own frontends, from CORS_ALLOWED_ORIGINS.
+// Rules are checked in order, so the specific ones go first.
+func newCORSRules(appOrigins []string) []corsRule {
+	public := corsPolicy{anyOrigin: true}
+	return []corsRule{
+		{methods: []string{"GET", "HEAD"}, prefix: "/api/chirps", policy: public},
+		{methods: []string{"GET", "HEAD"}, prefix: "/api/healthz", policy: public},
+		{methods: []string{"GET", "HEAD"}, prefix: "/api/readyz", policy: public},
+		{methods: []string{"GET", "HEAD"}, prefix: "/api/version", policy: public},
+		{methods: []string{"GET", "HEAD"}, prefix: "/api/openapi.json", policy: public},
+		{prefix: "/api/", policy: corsPolicy{origins: appOrigins, allowCredentials: true}},
+		{prefix: "/admin/", policy: corsPolicy{origins: appOrigins, allowCredentials: true}},
+	}
+}
+
+// parseOrigins splits CORS_ALLOWED_ORIGINS ("https://a.example.com,https://b.example.com") into a list
+func parseOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/") // browsers never send the trailing slash
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// middlewareCORS adds CORS headers according to the first of cfg.corsRules that matches, and answers
+// preflight (OPTIONS) requests itself. Requests from origins the policy doesn't allow just get no CORS
+// headers - the browser then blocks the response, and non-browser clients never cared.
+func (cfg *apiConfig) middlewareCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin") // the answer depends on who's asking, so caches must keep them apart
+
+		origin := r.Header.Get("Origin")
+		if origin == "" { // not a cross-origin browser request
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		isPreflight := r.Method == http.MethodOptions && requestedMethod != ""
+		method := r.Method
+		if isPreflight {
+			method = requestedMethod // the preflight asks about the request that's coming next
+		}
+
+		policy, ok := cfg.corsPolicyFor(method, r.URL.Path)
+		allowed := ok && policy.allows(origin)
+		if allowed {
+			if policy.anyOrigin {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.allowCredentials && !policy.anyOrigin {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		if !isPreflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Methods", method)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (cfg *apiConfig) corsPolicyFor(method, path string) (corsPolicy, bool) {
+	for _, rule := range cfg.corsRules {
+		if rule.matches(method, path) {
+			return rule.policy, true
+		}
+	}
+	return corsPolicy{}, false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	db := newMockDB()
+	_, token := createTestUser(t, db, "lydia@madrigal.com", "stevia")
+	cfg := newTestConfig(db)
+	cfg.corsRules = newCORSRules([]string{"https://chirpy.example.com"})
+	server := newTestServer(cfg)
+	defer server.Close()
+
+	cases := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflightMethod string // Access-Control-Request-Method, for OPTIONS
+		wantOrigin      string // Access-Control-Allow-Origin ("" for none)
+		wantCredentials bool
+	}{
+		{"public read from anywhere", "GET", "/api/version", "https://elsewhere.com", "", "*", false},
+		{"public chirp read from anywhere", "OPTIONS", "/api/chirps/123", "https://elsewhere.com", "GET", "*", false},
+		{"login from our app", "OPTIONS", "/api/login", "https://chirpy.example.com", "POST", "https://chirpy.example.com", true},
+		{"login from elsewhere", "OPTIONS", "/api/login", "https://elsewhere.com", "POST", "", false},
+		{"posting a chirp from elsewhere", "OPTIONS", "/api/chirps", "https://elsewhere.com", "POST", "", false},
+		{"posting a chirp from our app", "OPTIONS", "/api/chirps", "https://chirpy.example.com", "POST", "https://chirpy.example.com", true},
+		{"whoami from our app", "GET", "/api/whoami", "https://chirpy.example.com", "", "https://chirpy.example.com", true},
+		{"whoami from elsewhere", "GET", "/api/whoami", "https://elsewhere.com", "", "", false},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, server.URL+c.path, nil)
+		if err != nil {
+			t.Fatalf("error building request: %v", err)
+		}
+		req.Header.Set("Origin", c.origin)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if c.preflightMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", c.preflightMethod)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("error sending request: %v", err)
+		}
+		resp.Body.Close()
+
+		if got := resp.Header.Get("Access-Control-Allow-Origin"); got != c.wantOrigin {
+			t.Errorf("%v: expected Access-Control-Allow-Origin: %q, got: %q", c.name, c.wantOrigin, got)
+		}
+		if got := resp.Header.Get("Access-Control-Allow-Credentials") == "true"; got != c.wantCredentials {
+			t.Errorf("%v: expected credentials allowed: %v, got: %v", c.name, c.wantCredentials, got)
+		}
+		if c.preflightMethod != "" && resp.StatusCode != 204 {
+			t.Errorf("%v: expected status: 204 for a preflight, got: %v", c.name, resp.StatusCode)
+		}
+		if c.preflightMethod == "" && resp.StatusCode != 200 {
+			t.Errorf("%v: expected status: 200, got: %v", c.name, resp.StatusCode)
+		}
+	}
+}
+
+// every header the API sets for clients to read has to be exposed, or browser scripts can't see it
+func TestCORSExposedHeaders(t *testing.T) {
+	cfg := newTestConfig(newMockDB())
+	cfg.corsRules = newCORSRules([]string{"https://chirpy.example.com"})
+	server := newTestServer(cfg)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL+"/api/version", nil)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	req.Header.Set("Origin", "https://elsewhere.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	resp.Body.Close()
+
+	exposed := map[string]bool{}
+	for _, header := range strings.Split(resp.Header.Get("Access-Control-Expose-Headers"), ",") {
+		exposed[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+	for _, header := range []string{"X-Request-ID", "X-Total-Count", "Last-Modified", "ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"} {
+		if !exposed[http.CanonicalHeaderKey(header)] {
+			t.Errorf("expected %v in Access-Control-Expose-Headers, got: %q", header, resp.Header.Get("Access-Control-Expose-Headers"))
+		}
+	}
+}
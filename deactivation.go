@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDeactivationGrace = 30 * 24 * time.Hour  // how long a deactivated account can still come back (USER_DEACTIVATION_GRACE)
+	maxDeactivationGrace     = 365 * 24 * time.Hour // past this we're just keeping data people asked us to delete
+	purgeInterval            = time.Hour            // how often runPurge looks for accounts past their grace period
+)
+
+// DELETE /api/users - deactivates the caller's account. It's hidden straight away (their profile 404s and their
+// chirps drop out of the feeds) and every token they hold stops working, but nothing is deleted yet: logging in
+// again within the grace period brings it all back. After that, runPurge deletes it for good.
+func (cfg *apiConfig) middlewareMetricsDeactivateUser(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	var deactivated int64
+	err := cfg.withTx(ctx, func(q database.Querier) error {
+		var err error
+		deactivated, err = q.DeactivateUser(ctx, userID)
+		if err != nil || deactivated == 0 {
+			return err
+		}
+		return q.TouchChirpList(ctx) // their chirps just left the list
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error deactivating user", err, "user_id", userID)
+		return
+	}
+	if deactivated == 0 { // deleted since the token was issued (a deactivated user's tokens are already revoked)
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+
+	cfg.revokedSessions.revoke(userID, time.Now())
+	slog.Info("user deactivated", "user_id", userID, "request_id", requestIDFromContext(req.Context()))
+	w.WriteHeader(204)
+}
+
+var errAccountDeactivated = errors.New("account deactivated")
+
+// checkAccountActive returns errAccountDeactivated if userID's account is deactivated. Deactivating revokes
+// the user's tokens in sessionDenylist too, but that's only this process's memory: after a restart, or on
+// another instance, the database is what still knows. A user that's gone altogether isn't an error here -
+// handlers already answer 404 for that - and any other error is returned as is.
+func (cfg *apiConfig) checkAccountActive(ctx context.Context, userID uuid.UUID) error {
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	dbUser, err := withRetry(dbCtx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dbUser.DeactivatedAt.Valid {
+		return errAccountDeactivated
+	}
+	return nil
+}
+
+// canReactivate reports whether an account deactivated at deactivatedAt is still within its grace period
+func (cfg *apiConfig) canReactivate(deactivatedAt time.Time) bool {
+	return time.Now().UTC().Sub(deactivatedAt) < cfg.deactivationGrace
+}
+
+// runPurge deletes accounts that have been deactivated for longer than the grace period, every purgeInterval
+// until ctx is done. main() runs it in the background once the server is ready.
+func (cfg *apiConfig) runPurge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		cfg.purgeDeactivatedUsers(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeDeactivatedUsers(ctx context.Context) {
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	purged, err := cfg.db.PurgeDeactivatedUsers(dbCtx, time.Now().UTC().Add(-cfg.deactivationGrace))
+	if err != nil {
+		slog.Error("error purging deactivated users", "error", err)
+		return
+	}
+	if purged > 0 {
+		// their chirps went too (ON DELETE CASCADE), and we don't know which ones were cached
+		cfg.chirpCache.Clear()
+		slog.Info("purged deactivated users", "count", purged)
+	}
+}
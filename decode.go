@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// the most each route reads of a JSON request body. Anything bigger gets 413 before we bother parsing it.
+const (
+	maxChirpRequestSize = 4 << 10  // bytes; plenty for a chirp plus its JSON wrapper, like socketMaxMessage
+	maxRequestSize      = 16 << 10 // bytes; everything else - credentials, tokens, a report reason...
+)
+
+// decodeJSONBody decodes req's JSON body into dst, reading at most limit bytes of it. If that fails it
+// answers the request itself - 413 for a body over limit, 400 for an empty or malformed one - and
+// returns false, so the handler just returns.
+func decodeJSONBody(w http.ResponseWriter, req *http.Request, limit int64, dst any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, req.Body, limit)).Decode(dst)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithBodyTooLarge(w, tooLarge.Limit)
+		return false
+	}
+	if isEmptyBody(err) {
+		respondWithError(w, 400, errCodeInvalidJSON, "request body is empty")
+		return false
+	}
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidJSON, "Error decoding params")
+		return false
+	}
+	return true
+}
+
+// respondWithBodyTooLarge sends 413, saying what the route's limit is so the client knows how far to trim
+func respondWithBodyTooLarge(w http.ResponseWriter, limit int64) {
+	respondWithError(w, 413, errCodeTooLarge, fmt.Sprintf("request body must be at most %d bytes", limit))
+}
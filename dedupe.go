@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// findDuplicateChirp looks for a chirp userID already posted within cfg.chirpDedupeWindow that a new one
+// with these fields would just be a copy of (a double-tapped button, a client retrying a request whose
+// response it never got). The body is compared as it would be stored, so censored. Returns sql.ErrNoRows
+// if there isn't one.
+//
+// It's a best effort: two copies sent at exactly the same moment can both miss each other and both be saved.
+func (cfg *apiConfig) findDuplicateChirp(ctx context.Context, userID uuid.UUID, body string, visibility database.ChirpVisibility, lang sql.NullString, status database.ChirpStatus, mediaURL sql.NullString) (Chirp, error) {
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	duplicate, err := cfg.db.GetRecentIdenticalChirp(dbCtx, database.GetRecentIdenticalChirpParams{
+		UserID:     userID,
+		Body:       cfg.censor(body),
+		Visibility: visibility,
+		Status:     status,
+		Lang:       lang,
+		MediaUrl:   mediaURL,
+		Since:      time.Now().UTC().Add(-cfg.chirpDedupeWindow),
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirpFromDB(duplicate), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+)
+
+const (
+	defaultRandomChirps = 10
+	maxRandomChirps     = 25
+)
+
+// GET /api/chirps/random?count=N - up to N (default 10, at most 25) random public chirps, for a "discover" page.
+// Logged in, your own chirps are left out - you've already seen those.
+func (cfg *apiConfig) middlewareMetricsGetRandomChirps(w http.ResponseWriter, req *http.Request) {
+	loc, err := parseTimezone(req.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	count := defaultRandomChirps
+	if countParam := req.URL.Query().Get("count"); countParam != "" {
+		count, err = strconv.Atoi(countParam)
+		if err != nil || count < 1 {
+			respondWithError(w, 400, errCodeBadRequest, "count must be a positive number")
+			return
+		}
+		count = min(count, maxRandomChirps) // asking for more isn't an error, you just get the most we give out
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbChirps, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.Chirp, error) {
+		return cfg.db.GetRandomChirps(ctx, database.GetRandomChirpsParams{
+			ExcludeUserID: viewerFromContext(req.Context()),
+			Count:         int32(count),
+		})
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error retrieving chirps", err)
+		return
+	}
+
+	chirps := []Chirp{} // [] rather than null when there's nothing to show
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, chirpFromDB(chirp).inTimezone(loc))
+	}
+	jsonWriter(w, 200, chirps)
+}
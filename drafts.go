@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var errUnknownStatus = errors.New(`status must be "draft" or "published"`)
+
+// parseChirpStatus turns the status field of a create request into the database enum; empty means published
+func parseChirpStatus(name string) (database.ChirpStatus, error) {
+	switch database.ChirpStatus(name) {
+	case "", database.ChirpStatusPublished:
+		return database.ChirpStatusPublished, nil
+	case database.ChirpStatusDraft:
+		return database.ChirpStatusDraft, nil
+	}
+	return "", errUnknownStatus
+}
+
+// POST /api/chirps/{chirpID}/publish - posts one of your drafts. It goes to the top of the timeline
+// (created_at becomes now) and out to live subscribers if it's public. Publishing twice is a 409.
+func (cfg *apiConfig) middlewareMetricsPublishChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	// someone else's draft is a 404 like their private chirps, so this can't be used to find out it exists
+	if err != nil || !canView(dbChirp, uuid.NullUUID{UUID: userID, Valid: true}) {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+	if dbChirp.UserID != userID {
+		respondWithError(w, 403, errCodeForbidden, "you can only publish your own chirps")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	published, err := cfg.db.PublishChirp(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) { // not a draft (any more)
+		respondWithError(w, 409, errCodeAlreadyPublished, "chirp is already published")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error publishing chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	cfg.chirpCache.Remove(chirpUUID) // cached copy is still a draft
+
+	mainChirp := chirpFromDB(published)
+	if isBroadcast(published) {
+		cfg.chirpHub.Publish(mainChirp)
+	}
+	jsonWriter(w, 200, mainChirp)
+}
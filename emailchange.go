@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// how long the link to confirm a new email address works for
+const emailChangeLifetime = 24 * time.Hour
+
+// how long requestEmailChange makes you wait after the last token went out, so neither
+// POST /api/users/email/resend nor PATCH /api/users can be used to flood someone's inbox
+const emailResendCooldown = time.Minute
+
+type ConfirmEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// emailCooldownError is what requestEmailChange returns within emailResendCooldown of the last token
+type emailCooldownError struct {
+	wait time.Duration
+}
+
+func (e *emailCooldownError) Error() string {
+	return "email change token sent too recently"
+}
+
+// emailChangeCooldown is how much longer userID has to wait before another token can go out, or 0.
+func (cfg *apiConfig) emailChangeCooldown(ctx context.Context, userID uuid.UUID) (time.Duration, error) {
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	change, err := withRetry(dbCtx, cfg.dbRetry, func(ctx context.Context) (database.EmailChange, error) {
+		return cfg.db.GetEmailChange(ctx, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// created_at is reset every time a token is sent, so it's when the last one went out
+	return max(change.CreatedAt.Add(emailResendCooldown).Sub(time.Now().UTC()), 0), nil
+}
+
+// respondWithEmailCooldown sends 429 with a Retry-After for an *emailCooldownError
+func respondWithEmailCooldown(w http.ResponseWriter, cooldown *emailCooldownError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.wait.Seconds()))))
+	respondWithError(w, 429, errCodeRateLimited, "a token was sent recently, please wait before asking again")
+}
+
+// requestEmailChange saves newEmail as userID's pending email, replacing any earlier request, and
+// sends out the confirmation token. The old email keeps working until the token comes back.
+// Returns an *emailCooldownError if the last token went out less than emailResendCooldown ago.
+func (cfg *apiConfig) requestEmailChange(req *http.Request, userID uuid.UUID, newEmail string) error {
+	wait, err := cfg.emailChangeCooldown(req.Context(), userID)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &emailCooldownError{wait: wait}
+	}
+
+	token, err := auth.MakeToken()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	err = cfg.db.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+		UserID:    userID,
+		NewEmail:  newEmail,
+		TokenHash: auth.HashToken(token), // only the user gets the token itself
+		ExpiresAt: time.Now().UTC().Add(emailChangeLifetime),
+	})
+	if err != nil {
+		return err
+	}
+
+	// there's no mail sending yet, so the token goes to the server log instead of to newEmail
+	slog.Info("email change requested",
+		"user_id", userID,
+		"new_email", newEmail,
+		"token", token,
+		"request_id", requestIDFromContext(req.Context()),
+	)
+	return nil
+}
+
+// POST /api/users/email/confirm - applies a pending email change. No login needed: the token is the proof,
+// and it's only ever sent to the new address.
+func (cfg *apiConfig) middlewareMetricsConfirmEmailChange(w http.ResponseWriter, req *http.Request) {
+	params := ConfirmEmailRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	change, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.EmailChange, error) {
+		return cfg.db.GetEmailChangeByToken(ctx, auth.HashToken(params.Token))
+	})
+	cancel()
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && time.Now().UTC().After(change.ExpiresAt)) {
+		respondWithError(w, 400, errCodeBadRequest, "invalid or expired token")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting email change", err)
+		return
+	}
+
+	var dbUser database.User
+	err = cfg.withTx(req.Context(), func(q database.Querier) error {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+
+		var err error
+		dbUser, err = q.UpdateUser(ctx, database.UpdateUserParams{
+			ID:    change.UserID,
+			Email: sql.NullString{String: change.NewEmail, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return q.DeleteEmailChange(ctx, change.UserID) // so the token can't be used twice
+	})
+	if isUniqueViolation(err) { // someone else signed up with it in the meantime
+		respondWithError(w, 409, errCodeEmailTaken, "email already in use")
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error confirming email change", err, "user_id", change.UserID)
+		return
+	}
+
+	jsonWriter(w, 200, userFromDB(dbUser))
+}
+
+// POST /api/users/email/resend - sends a fresh token for the caller's pending email change (the old one
+// stops working), for when the first never arrived or has expired. 404 if there's nothing pending, and
+// 429 (with Retry-After) within emailResendCooldown of the last one.
+func (cfg *apiConfig) middlewareMetricsResendEmailChange(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	change, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.EmailChange, error) {
+		return cfg.db.GetEmailChange(ctx, userID)
+	})
+	cancel()
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, errCodeNotFound, "no email change pending")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting email change", err, "user_id", userID)
+		return
+	}
+
+	err = cfg.requestEmailChange(req, userID, change.NewEmail)
+	var cooldown *emailCooldownError
+	if errors.As(err, &cooldown) {
+		respondWithEmailCooldown(w, cooldown)
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error resending email change", err, "user_id", userID)
+		return
+	}
+	w.WriteHeader(204)
+}
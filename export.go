@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// how many chirps GET /api/chirps/export reads per query; only one batch is ever held in memory
+const exportBatchSize = 500
+
+// GET /api/chirps/export - every chirp, drafts and private ones included (so admins only), as
+// newline-delimited JSON: one Chirp object per line, in id order. It's streamed a batch at a time,
+// so it doesn't matter how many chirps there are. If the database fails partway through, the status
+// has already gone out as 200; the stream just stops, so clients should check the count if it matters.
+func (cfg *apiConfig) middlewareMetricsExportChirps(w http.ResponseWriter, req *http.Request) {
+	encoder := json.NewEncoder(w) // Encode ends each value with a newline, which is all NDJSON is
+	started := false
+	exported := 0
+	lastID := uuid.Nil // walked in id order, like POST /admin/refilter
+
+	for {
+		ctx, cancel := cfg.dbContext(req.Context())
+		batch, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.Chirp, error) {
+			return cfg.db.GetChirpsAfterID(ctx, database.GetChirpsAfterIDParams{
+				ID:    lastID,
+				Limit: exportBatchSize,
+			})
+		})
+		cancel()
+		if err != nil && !started {
+			cfg.respondWithDBError(w, req, "error exporting chirps", err)
+			return
+		}
+		if err != nil {
+			logRequestError(req, "error exporting chirps, stream cut short", err, "exported", exported)
+			return
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(200)
+			started = true
+		}
+		for _, chirp := range batch {
+			err := encoder.Encode(chirpFromDB(chirp))
+			if err != nil {
+				return // the client has gone away
+			}
+			exported++
+		}
+		http.NewResponseController(w).Flush() // let this batch go before reading the next
+
+		if len(batch) < exportBatchSize {
+			return
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgon2Password(t *testing.T) {
+	hash, err := HashPasswordArgon2("correct horse")
+	if err != nil {
+		t.Fatalf("error hashing password: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("expected a PHC-format argon2id hash, got: %v", hash)
+	}
+
+	if err := CheckPasswordArgon2("correct horse", hash); err != nil {
+		t.Errorf("expected the password to match: %v", err)
+	}
+	if err := CheckPasswordArgon2("wrong horse", hash); err == nil {
+		t.Errorf("expected the wrong password not to match")
+	}
+	if _, err := HashPasswordArgon2(""); err == nil {
+		t.Errorf("expected an error for an empty password")
+	}
+
+	for _, bad := range []string{"", "$argon2id$v=19$m=1,t=1,p=1$!!!$!!!", "$argon2i$v=19$m=1,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=16$m=1,t=1,p=1$c2FsdA$a2V5"} {
+		if err := CheckPasswordArgon2("correct horse", bad); err == nil {
+			t.Errorf("expected an error for malformed hash %q", bad)
+		}
+	}
+}
+
+func TestCheckPasswordHashDetectsFormat(t *testing.T) {
+	for _, algo := range []PasswordAlgorithm{PasswordBcrypt, PasswordArgon2id} {
+		hash, err := algo.Hash("correct horse")
+		if err != nil {
+			t.Fatalf("%v: error hashing password: %v", algo, err)
+		}
+		if err := CheckPasswordHash("correct horse", hash); err != nil {
+			t.Errorf("%v: expected the password to match: %v", algo, err)
+		}
+		if err := CheckPasswordHash("wrong horse", hash); err == nil {
+			t.Errorf("%v: expected the wrong password not to match", algo)
+		}
+	}
+
+	if _, err := ParsePasswordAlgorithm("md5"); err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+	if algo, err := ParsePasswordAlgorithm(""); err != nil || algo != PasswordBcrypt {
+		t.Errorf("expected bcrypt by default, got: %v (error %v)", algo, err)
+	}
+}
@@ -11,6 +11,34 @@ import (
 	"golang.org/x/crypto/bcrypt" // "go get golang.org/x/crypto/bcrypt" //to install
 )
 
+// PasswordAlgorithm picks how new password hashes are made (PASSWORD_ALGO). Checking doesn't need
+// it: CheckPasswordHash tells the formats apart, so switching algorithms keeps old hashes working.
+type PasswordAlgorithm string
+
+const (
+	PasswordBcrypt   PasswordAlgorithm = "bcrypt" // the default
+	PasswordArgon2id PasswordAlgorithm = "argon2id"
+)
+
+// ParsePasswordAlgorithm turns "bcrypt" or "argon2id" into a PasswordAlgorithm; empty means bcrypt.
+func ParsePasswordAlgorithm(name string) (PasswordAlgorithm, error) {
+	switch PasswordAlgorithm(strings.ToLower(name)) {
+	case "", PasswordBcrypt:
+		return PasswordBcrypt, nil
+	case PasswordArgon2id:
+		return PasswordArgon2id, nil
+	}
+	return "", fmt.Errorf("unknown password algorithm %q (want bcrypt or argon2id)", name)
+}
+
+// Hash hashes password with algo (bcrypt for the zero value).
+func (algo PasswordAlgorithm) Hash(password string) (string, error) {
+	if algo == PasswordArgon2id {
+		return HashPasswordArgon2(password)
+	}
+	return HashPassword(password)
+}
+
 func HashPassword(password string) (string, error) {
 	// func GenerateFromPassword(password []byte, cost int) ([]byte, error)
 	// bcrypt.DefaultCost is the default cost, otherwise needs to be specified
@@ -27,7 +55,11 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
+// CheckPasswordHash checks password against a bcrypt or argon2id hash (whichever hash is).
 func CheckPasswordHash(password, hash string) error {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		return CheckPasswordArgon2(password, hash)
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
 		return fmt.Errorf("password does not match: %w", err)
@@ -35,7 +67,16 @@ func CheckPasswordHash(password, hash string) error {
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// MakeJWT signs a token for userID. If audience is non-empty it's stored in the "aud" claim
+// (the client ID, e.g. "chirpy-web" or "chirpy-mobile") so the token can be scoped to that client.
+// (With more than one key in play, use KeySet.MakeJWT instead.)
+func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, audience string) (string, error) {
+	return makeJWT(userID, Key{Secret: tokenSecret}, expiresIn, audience)
+}
+
+// makeJWT does the actual signing for MakeJWT and KeySet.MakeJWT. If key has an ID it goes in the
+// token's "kid" header, so ValidateJWT knows which key to check it with.
+func makeJWT(userID uuid.UUID, key Key, expiresIn time.Duration, audience string) (string, error) {
 
 	//Create a variable to hold the "claims"—the standard fields about the token and user.
 	var newClaims jwt.RegisteredClaims
@@ -57,13 +98,21 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	// This identifies the user the token is about.
 	newClaims.Subject = userID.String()
 
+	// Scope the token to a specific client app, if we were given one.
+	if audience != "" {
+		newClaims.Audience = jwt.ClaimStrings{audience}
+	}
+
 	//Create a new token and tell the JWT library to sign it
 	// using HMAC SHA256, including your claims from above.
 	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims)
+	if key.ID != "" {
+		newToken.Header["kid"] = key.ID
+	}
 
 	//Sign (cryptographically seal) the token using your secret.
 	// This produces a "JWT string"—just a base64 string you can hand out.
-	jwtString, err := newToken.SignedString([]byte(tokenSecret)) // secret needs to be []byte, not string
+	jwtString, err := newToken.SignedString([]byte(key.Secret)) // secret needs to be []byte, not string
 	//jwtString, err := newToken.SignedString(tokenSecret) //WRONG!
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
@@ -71,10 +120,26 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return jwtString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// ValidateJWT checks the token and returns the user ID it was issued for.
+// If expectedAudience is non-empty, the token's "aud" claim must contain it
+// (so a token minted for one client app is rejected by another). Pass "" to skip the check.
+// (With more than one key in play, use KeySet.ValidateJWT instead.)
+func ValidateJWT(tokenString, tokenSecret, expectedAudience string) (uuid.UUID, error) {
+	return validateJWT(tokenString, Key{Secret: tokenSecret}, expectedAudience)
+}
+
+// validateJWT does the actual checking for ValidateJWT and KeySet.ValidateJWT, against a single key.
+func validateJWT(tokenString string, key Key, expectedAudience string) (uuid.UUID, error) {
 	// Prepare a place to extract the claims from the incoming token.
 	var registeredClaims jwt.RegisteredClaims
 
+	// Only accept HS256. The library enforces this BEFORE our key function runs, which shuts down
+	// the classic "alg: none" trick (and HS384/HS512 or RSA tokens) even if the key function changes later.
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})}
+	if expectedAudience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(expectedAudience)) // library rejects missing/wrong aud
+	}
+
 	//  Parse the token string using the JWT library and try to populate registeredClaims.
 	// - The callback checks the signature method and passes in your secret so
 	// the JWT library can verify the authenticity.
@@ -87,8 +152,8 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 			if token.Method != jwt.SigningMethodHS256 {
 				return nil, fmt.Errorf("wrong jwt signature")
 			}
-			return []byte(tokenSecret), nil
-		})
+			return []byte(key.Secret), nil
+		}, parserOptions...)
 
 	if err != nil {
 		return uuid.UUID{}, fmt.Errorf("error validating: %w", err)
@@ -116,26 +181,34 @@ func GetBearerToken(headers http.Header) (string, error) {
 		return the TOKEN_STRING if it exists (stripping off the Bearer prefix and whitespace).
 		If the header doesn't exist, return an error.
 	*/
+	return authorizationToken(headers, "Bearer")
+}
 
+// GetAPIKey returns the key from an "Authorization: ApiKey THE_KEY" header - how other services
+// (rather than users) authenticate, e.g. for POST /api/introspect.
+func GetAPIKey(headers http.Header) (string, error) {
+	return authorizationToken(headers, "ApiKey")
+}
+
+// authorizationToken returns the credentials from an "Authorization: <scheme> <credentials>" header
+func authorizationToken(headers http.Header, scheme string) (string, error) {
 	tokenStringHeader := headers.Get("Authorization") // get the first item with this key
 	if tokenStringHeader == "" {
 		return "", fmt.Errorf("unable to retrieve authorization header")
 	}
 
-	tokenStringHeader = strings.TrimSpace(tokenStringHeader) // trim leading whitespace
-
-	if !strings.HasPrefix(tokenStringHeader, "Bearer ") { // checks for proper header leader.
-		//  Note, "space" after Bearer to make sure that's all that's there,
-		//  not something like "BearerToken" which would be invalid
+	// Fields splits on ANY run of whitespace and drops leading/trailing whitespace,
+	// so "Bearer  TOKEN" and " Bearer TOKEN " both become ["Bearer", "TOKEN"].
+	// Anything other than exactly scheme + token (e.g. "BearerTOKEN", or "Bearer a b") is invalid.
+	fields := strings.Fields(tokenStringHeader)
+	if len(fields) != 2 {
 		return "", fmt.Errorf("invalid authorization header")
-
 	}
 
-	token := strings.TrimPrefix(tokenStringHeader, "Bearer")
-
-	token = strings.TrimSpace(token)
-	if len(token) < 30 {
-		return "", fmt.Errorf("invalid token")
+	// the auth scheme is case-insensitive (RFC 7235), so "bearer" and "BEARER" are fine too
+	if !strings.EqualFold(fields[0], scheme) {
+		return "", fmt.Errorf("invalid authorization header")
 	}
-	return token, nil
+
+	return fields[1], nil
 }
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultPwnedPasswordsURL = "https://api.pwnedpasswords.com"
+
+// HTTPClient is the part of *http.Client that BreachChecker uses, so tests can swap in a fake.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// BreachChecker looks passwords up in HaveIBeenPwned's Pwned Passwords range API.
+// Only the first 5 hex characters of the password's SHA-1 ever leave the server (k-anonymity):
+// the API answers with every breached hash starting with them, and the match happens here.
+type BreachChecker struct {
+	Client  HTTPClient // nil means http.DefaultClient; give it a timeout via ctx
+	BaseURL string     // "" means the real API
+}
+
+// IsBreached reports whether password has appeared in a known data breach.
+// An error means we couldn't find out (the API was unreachable or answered oddly), not that it's breached.
+func (c BreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = defaultPwnedPasswordsURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/range/"+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("error building breach check request: %w", err)
+	}
+	// padding hides how many hashes matched the prefix from anyone watching the response size
+	req.Header.Set("Add-Padding", "true")
+	req.Header.Set("User-Agent", "chirpy")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error calling breach check API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breach check API responded %d", resp.StatusCode)
+	}
+
+	// one "SUFFIX:COUNT" per line; padding entries have a count of 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok && strings.EqualFold(lineSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading breach check response: %w", err)
+	}
+	return false, nil
+}
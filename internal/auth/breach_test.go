@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeHTTPClient answers every request with body (or fails with err), and remembers the last URL asked for
+type fakeHTTPClient struct {
+	body    string
+	status  int
+	err     error
+	lastURL string
+}
+
+func (c *fakeHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.lastURL = req.URL.String()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &http.Response{StatusCode: c.status, Body: io.NopCloser(strings.NewReader(c.body))}, nil
+}
+
+func TestIsBreached(t *testing.T) {
+	// SHA-1("password") is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	client := &fakeHTTPClient{
+		status: 200,
+		body:   "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n",
+	}
+	checker := BreachChecker{Client: client, BaseURL: "https://pwned.example"}
+
+	breached, err := checker.IsBreached(context.Background(), "password")
+	if err != nil || !breached {
+		t.Errorf("expected password to be breached, got: %v and %v", breached, err)
+	}
+	if client.lastURL != "https://pwned.example/range/5BAA6" {
+		t.Errorf("expected only the 5 character prefix to be sent, got: %v", client.lastURL)
+	}
+
+	breached, err = checker.IsBreached(context.Background(), "correct horse battery staple, but longer")
+	if err != nil || breached {
+		t.Errorf("expected an unknown password not to be breached, got: %v and %v", breached, err)
+	}
+
+	// padding entries (count 0) don't count as a match
+	client.body = "1E4C9B93F3F0682250B6CF8331B7EE68FD8:0\r\n"
+	breached, err = checker.IsBreached(context.Background(), "password")
+	if err != nil || breached {
+		t.Errorf("expected a padding entry not to match, got: %v and %v", breached, err)
+	}
+
+	client.status = 503
+	if _, err := checker.IsBreached(context.Background(), "password"); err == nil {
+		t.Errorf("expected error for a 503 from the API, got none")
+	}
+
+	client.err = errors.New("connection refused")
+	if _, err := checker.IsBreached(context.Background(), "password"); err == nil {
+		t.Errorf("expected error when the API is unreachable, got none")
+	}
+}
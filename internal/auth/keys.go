@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Key is a JWT signing secret. ID ends up in each token's "kid" header, so it must NOT be secret itself.
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// KeySet lets the signing secret be rotated without logging everyone out at once:
+// new tokens are always signed with Primary, but tokens signed with a Previous key still validate
+// until that key is dropped from the list (i.e. once its tokens have had time to expire).
+type KeySet struct {
+	Primary  Key
+	Previous []Key
+}
+
+// ParseKeys turns "id1:secret1,id2:secret2" into keys (for KeySet.Previous). Secrets may contain
+// colons; IDs may not. Empty input means no keys.
+func ParseKeys(list string) ([]Key, error) {
+	var keys []Key
+	for i, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || secret == "" {
+			// don't echo the entry back - it may well be a bare secret
+			return nil, fmt.Errorf("invalid key at position %d (want id:secret)", i+1)
+		}
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+	return keys, nil
+}
+
+// ParseSecrets turns "newest,older,..." into a KeySet for the simpler kind of rotation: new tokens
+// are signed with the first secret and any of them validates. None get an ID, so tokens carry no
+// "kid" and each secret is tried in turn. Empty input is an error - there'd be nothing to sign with.
+func ParseSecrets(list string) (KeySet, error) {
+	var secrets []Key
+	for i, secret := range strings.Split(list, ",") {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			return KeySet{}, fmt.Errorf("empty secret at position %d", i+1)
+		}
+		secrets = append(secrets, Key{Secret: secret})
+	}
+	return KeySet{Primary: secrets[0], Previous: secrets[1:]}, nil
+}
+
+// MakeJWT is MakeJWT, signed with the primary key.
+func (ks KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration, audience string) (string, error) {
+	return makeJWT(userID, ks.Primary, expiresIn, audience)
+}
+
+// ValidateJWT is ValidateJWT, checked against the right key from the set (see tryKeys).
+func (ks KeySet) ValidateJWT(tokenString, expectedAudience string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	err := ks.tryKeys(tokenString, func(key Key) error {
+		var err error
+		userID, err = validateJWT(tokenString, key, expectedAudience)
+		return err
+	})
+	return userID, err
+}
+
+// tryKeys runs validate with the right key from the set: the one named by the token's "kid" header if it
+// has one (a kid we don't know means the key was retired, so the token is rejected), otherwise each key
+// in turn, primary first, until one works - tokens issued before kids were added don't have one.
+func (ks KeySet) tryKeys(tokenString string, validate func(key Key) error) error {
+	keys := append([]Key{ks.Primary}, ks.Previous...)
+
+	kid, err := tokenKeyID(tokenString)
+	if err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	if kid != "" {
+		for _, key := range keys {
+			if key.ID == kid {
+				return validate(key)
+			}
+		}
+		return fmt.Errorf("error validating: unknown key id %q", kid)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		err := validate(key)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// TokenInfo is what KeySet.Introspect can tell another service about a valid token
+type TokenInfo struct {
+	UserID    uuid.UUID
+	ExpiresAt time.Time // zero if the token never expires
+	IssuedAt  time.Time
+}
+
+// Introspect is ValidateJWT, plus the token's expiry and issue time.
+func (ks KeySet) Introspect(tokenString, expectedAudience string) (TokenInfo, error) {
+	userID, err := ks.ValidateJWT(tokenString, expectedAudience)
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	// the signature's been checked by now, so reading the claims without checking again is safe
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return TokenInfo{}, fmt.Errorf("error reading claims: %w", err)
+	}
+	info := TokenInfo{UserID: userID}
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Time
+	}
+	return info, nil
+}
+
+// tokenKeyID reads the "kid" header WITHOUT checking the signature - it's only used to pick which
+// key to verify with, never trusted for anything else.
+func tokenKeyID(tokenString string) (string, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	if err != nil {
+		return "", err
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid, nil
+}
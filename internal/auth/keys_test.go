@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKey := Key{ID: "2025-01", Secret: "old-secret"}
+	newKey := Key{ID: "2026-10", Secret: "new-secret"}
+
+	before := KeySet{Primary: oldKey}
+	after := KeySet{Primary: newKey, Previous: []Key{oldKey}}
+	retired := KeySet{Primary: newKey} // old key dropped once its tokens have expired
+
+	oldToken, err := before.MakeJWT(userID, time.Hour, "")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	newToken, err := after.MakeJWT(userID, time.Hour, "")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	legacyToken, err := MakeJWT(userID, "old-secret", time.Hour, "") // from before tokens had a kid
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	forgedToken, err := makeJWT(userID, Key{ID: newKey.ID, Secret: "guessed"}, time.Hour, "") // right kid, wrong secret
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		keys    KeySet
+		token   string
+		wantErr bool
+	}{
+		{"new token, new key", after, newToken, false},
+		{"token signed with a previous key", after, oldToken, false},
+		{"token without a kid, previous key", after, legacyToken, false},
+		{"token signed with a retired key", retired, oldToken, true},
+		{"token without a kid, retired key", retired, legacyToken, true},
+		{"known kid, wrong secret", after, forgedToken, true},
+	}
+
+	for _, c := range cases {
+		gotID, err := c.keys.ValidateJWT(c.token, "")
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got none", c.name)
+			}
+			continue
+		}
+		if err != nil || gotID != userID {
+			t.Errorf("%s: expected user id %v and no error, got: %v and %v", c.name, userID, gotID, err)
+		}
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	userID := uuid.New()
+	keys := KeySet{Primary: Key{ID: "2026-10", Secret: "secret"}}
+
+	token, err := keys.MakeJWT(userID, time.Hour, "")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	info, err := keys.Introspect(token, "")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if info.UserID != userID {
+		t.Errorf("expected user id %v, got: %v", userID, info.UserID)
+	}
+	if until := time.Until(info.ExpiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("expected expiry about an hour from now, got: %v", info.ExpiresAt)
+	}
+
+	forged, _ := MakeJWT(userID, "guessed", time.Hour, "")
+	if _, err := keys.Introspect(forged, ""); err == nil {
+		t.Errorf("expected error for a token signed with the wrong secret, got none")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" a:one, b:two:with:colons ,")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != (Key{ID: "a", Secret: "one"}) || keys[1] != (Key{ID: "b", Secret: "two:with:colons"}) {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+
+	for _, bad := range []string{"just-a-secret", ":nosecretid", "noid:"} {
+		if _, err := ParseKeys(bad); err == nil {
+			t.Errorf("%q: expected error, got none", bad)
+		}
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	keys, err := ParseSecrets("new-secret, old-secret")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if keys.Primary != (Key{Secret: "new-secret"}) || len(keys.Previous) != 1 || keys.Previous[0] != (Key{Secret: "old-secret"}) {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+
+	// a token signed before the new secret was prepended still validates, and new ones get the new secret
+	userID := uuid.New()
+	oldToken, _ := MakeJWT(userID, "old-secret", time.Hour, "")
+	if gotID, err := keys.ValidateJWT(oldToken, ""); err != nil || gotID != userID {
+		t.Errorf("token signed with the second secret: expected user id %v and no error, got: %v and %v", userID, gotID, err)
+	}
+	newToken, _ := keys.MakeJWT(userID, time.Hour, "")
+	if _, err := ValidateJWT(newToken, "new-secret", ""); err != nil {
+		t.Errorf("expected new tokens to be signed with the first secret, got: %v", err)
+	}
+
+	for _, bad := range []string{"", "new-secret,", " , old-secret"} {
+		if _, err := ParseSecrets(bad); err == nil {
+			t.Errorf("%q: expected error, got none", bad)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// serviceSubjectPrefix marks a token's subject as a service account rather than a user. ValidateJWT only
+// accepts a bare user ID as the subject, so a service token can never be passed off as a user's, and
+// ValidateServiceJWT insists on the prefix, so it doesn't work the other way round either.
+const serviceSubjectPrefix = "service:"
+
+// serviceClaims are a service token's claims: the usual ones, plus what it's allowed to do
+type serviceClaims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"` // space-separated, the way OAuth writes scopes
+}
+
+// ServiceTokenInfo is what a valid service token says about the service account holding it
+type ServiceTokenInfo struct {
+	ClientID  uuid.UUID
+	Scopes    []string
+	ExpiresAt time.Time // zero if the token never expires
+	IssuedAt  time.Time
+}
+
+// HasScope reports whether the token was granted scope
+func (info ServiceTokenInfo) HasScope(scope string) bool {
+	return slices.Contains(info.Scopes, scope)
+}
+
+// MakeServiceJWT signs a token for the service account clientID, allowed to do scopes, with the primary key.
+// audience works as it does for MakeJWT.
+func (ks KeySet) MakeServiceJWT(clientID uuid.UUID, scopes []string, expiresIn time.Duration, audience string) (string, error) {
+	now := time.Now().UTC()
+	claims := serviceClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Subject:   serviceSubjectPrefix + clientID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		},
+		Scope: strings.Join(scopes, " "),
+	}
+	if audience != "" {
+		claims.Audience = jwt.ClaimStrings{audience}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if ks.Primary.ID != "" {
+		token.Header["kid"] = ks.Primary.ID
+	}
+	signed, err := token.SignedString([]byte(ks.Primary.Secret))
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %w", err)
+	}
+	return signed, nil
+}
+
+// ValidateServiceJWT checks a token made by MakeServiceJWT, the same way KeySet.ValidateJWT checks a user's,
+// and returns the service account it was issued to. A user's token is rejected.
+func (ks KeySet) ValidateServiceJWT(tokenString, expectedAudience string) (ServiceTokenInfo, error) {
+	var claims serviceClaims
+	err := ks.tryKeys(tokenString, func(key Key) error {
+		claims = serviceClaims{}
+		return parseServiceClaims(tokenString, key, expectedAudience, &claims)
+	})
+	if err != nil {
+		return ServiceTokenInfo{}, err
+	}
+
+	clientIDString, ok := strings.CutPrefix(claims.Subject, serviceSubjectPrefix)
+	if !ok {
+		return ServiceTokenInfo{}, errors.New("error validating: not a service token")
+	}
+	clientID, err := uuid.Parse(clientIDString)
+	if err != nil {
+		return ServiceTokenInfo{}, fmt.Errorf("error parsing client id: %w", err)
+	}
+
+	info := ServiceTokenInfo{ClientID: clientID, Scopes: strings.Fields(claims.Scope)}
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+	if claims.IssuedAt != nil {
+		info.IssuedAt = claims.IssuedAt.Time
+	}
+	return info, nil
+}
+
+// parseServiceClaims verifies tokenString with key into claims, with the same rules as validateJWT:
+// HS256 only, and the audience checked if there's one to expect.
+func parseServiceClaims(tokenString string, key Key, expectedAudience string, claims *serviceClaims) error {
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()})}
+	if expectedAudience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(expectedAudience))
+	}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(key.Secret), nil
+	}, parserOptions...)
+	if err != nil {
+		return fmt.Errorf("error validating: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestServiceJWT(t *testing.T) {
+	clientID := uuid.New()
+	keys := KeySet{Primary: Key{ID: "2026-10", Secret: "secret"}}
+
+	token, err := keys.MakeServiceJWT(clientID, []string{"introspect", "other"}, time.Hour, "chirpy-web")
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	info, err := keys.ValidateServiceJWT(token, "chirpy-web")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if info.ClientID != clientID || !slices.Equal(info.Scopes, []string{"introspect", "other"}) {
+		t.Errorf("expected client %v with scopes introspect and other, got: %v %v", clientID, info.ClientID, info.Scopes)
+	}
+	if !info.HasScope("introspect") || info.HasScope("admin") {
+		t.Errorf("expected HasScope to go by the granted scopes, got: %v", info.Scopes)
+	}
+	if until := time.Until(info.ExpiresAt); until <= 59*time.Minute || until > time.Hour {
+		t.Errorf("expected expiry about an hour from now, got: %v", info.ExpiresAt)
+	}
+
+	if _, err := keys.ValidateServiceJWT(token, "chirpy-mobile"); err == nil {
+		t.Errorf("wrong audience: expected error, got none")
+	}
+	forged, _ := KeySet{Primary: Key{ID: "2026-10", Secret: "guessed"}}.MakeServiceJWT(clientID, []string{"introspect"}, time.Hour, "")
+	if _, err := keys.ValidateServiceJWT(forged, ""); err == nil {
+		t.Errorf("wrong secret: expected error, got none")
+	}
+
+	// neither kind of token passes for the other
+	if _, err := keys.ValidateJWT(token, "chirpy-web"); err == nil {
+		t.Errorf("service token as a user's: expected error, got none")
+	}
+	userToken, _ := keys.MakeJWT(uuid.New(), time.Hour, "")
+	if _, err := keys.ValidateServiceJWT(userToken, ""); err == nil {
+		t.Errorf("user token as a service's: expected error, got none")
+	}
+}
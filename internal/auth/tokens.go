@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// MakeToken returns a random 256-bit token, hex encoded, for one-off links like confirming an email change.
+func MakeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken is what gets stored in place of a MakeToken token, so a leaked database can't be used to confirm anything.
+// Tokens are already random, so a plain SHA-256 is enough (no need for bcrypt's slowness).
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+func TestMakeToken(t *testing.T) {
+	first, err := MakeToken()
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	second, err := MakeToken()
+	if err != nil {
+		t.Fatalf("error making token: %v", err)
+	}
+	if len(first) != 64 {
+		t.Errorf("expected a 64 character token, got: %v", len(first))
+	}
+	if first == second {
+		t.Errorf("expected two different tokens, got %v twice", first)
+	}
+
+	if HashToken(first) != HashToken(first) {
+		t.Errorf("expected the same token to hash the same way twice")
+	}
+	if HashToken(first) == HashToken(second) || HashToken(first) == first {
+		t.Errorf("expected different tokens to hash differently, and not to themselves")
+	}
+}
@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a fixed-capacity, least-recently-used cache that's safe to share between goroutines
+// (every HTTP request runs in its own goroutine, so this matters!).
+//
+// When the cache is full, adding a new key evicts whichever key was used longest ago.
+type LRU[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List          // front = most recently used, back = least recently used
+	items    map[K]*list.Element // key -> element in order, for O(1) lookups
+	gen      uint64              // bumped by Remove and Clear, so GetOrLoad can tell its load may be stale
+}
+
+// the value stored in each list element; we keep the key so eviction can delete it from the map
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewLRU makes a cache holding at most capacity entries. capacity must be at least 1.
+func NewLRU[K comparable, V any](capacity int) *LRU[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRU[K, V]{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the cached value for key, marking it as recently used.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry[K, V]).value, true
+}
+
+// Add stores value under key, evicting the least recently used entry if the cache is full.
+func (c *LRU[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, value)
+}
+
+// add is Add for callers already holding c.mu
+func (c *LRU[K, V]) add(key K, value V) {
+	if elem, ok := c.items[key]; ok { // already cached: just refresh it
+		elem.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry[K, V]).key)
+	}
+}
+
+// GetOrLoad returns the cached value for key, or calls load on a miss and caches the result.
+// Errors from load are returned as-is and nothing is cached, so a failed lookup is retried next time.
+// (The lock isn't held while load runs, so two concurrent misses may both call load - that's fine for us.)
+// If a Remove or Clear happens while load runs, the result is returned but not cached: it may have been
+// read before the change that Remove was for, and caching it would bring the stale value back.
+func (c *LRU[K, V]) GetOrLoad(key K, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		value := elem.Value.(*entry[K, V]).value
+		c.mu.Unlock()
+		return value, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	value, err := load()
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen == gen {
+		c.add(key, value)
+	}
+	return value, nil
+}
+
+// Remove drops key from the cache (e.g. when the underlying record was edited or deleted).
+func (c *LRU[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if elem, ok := c.items[key]; ok {
+		c.order.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Clear drops every entry, for when too much has changed underneath to Remove keys one by one.
+func (c *LRU[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	clear(c.items)
+}
+
+// Len reports how many entries are currently cached.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestLRUGetAdd(t *testing.T) {
+	c := NewLRU[string, int](2)
+
+	if _, ok := c.Get("missing"); ok {
+		t.Errorf("expected miss on empty cache")
+	}
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	got, ok := c.Get("a")
+	if !ok || got != 1 {
+		t.Errorf("expected 1 and hit, got: %v and %v", got, ok)
+	}
+
+	// "a" was just used, so adding "c" should evict "b"
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Errorf("expected a to still be cached")
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected length: 2, got: %v", c.Len())
+	}
+}
+
+func TestLRURemove(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Add("a", 1)
+	c.Remove("a")
+	c.Remove("never-added") // shouldn't panic
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a to be removed")
+	}
+}
+
+func TestLRUClear(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Clear()
+
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Errorf("expected an empty cache, got %d entries", c.Len())
+	}
+	c.Add("c", 3) // still usable afterwards
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("expected c=3 after clearing, got %v, %v", v, ok)
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	c := NewLRU[string, int](10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint(i % 20)
+			c.Add(key, i)
+			c.Get(key)
+		}(i)
+	}
+	wg.Wait()
+
+	if c.Len() > 10 {
+		t.Errorf("expected at most 10 entries, got: %v", c.Len())
+	}
+}
+
+func TestLRUGetOrLoad(t *testing.T) {
+	c := NewLRU[string, int](2)
+
+	loads := 0
+	load := func() (int, error) { // stands in for the database
+		loads++
+		return 42, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := c.GetOrLoad("chirp", load)
+		if err != nil || got != 42 {
+			t.Errorf("expected 42 and no error, got: %v and %v", got, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected second read to skip the loader, loader called %v times", loads)
+	}
+
+	// failed loads aren't cached
+	_, err := c.GetOrLoad("broken", func() (int, error) { return 0, fmt.Errorf("db down") })
+	if err == nil {
+		t.Errorf("expected error from loader, got none")
+	}
+	if _, ok := c.Get("broken"); ok {
+		t.Errorf("expected failed load not to be cached")
+	}
+}
+
+func TestLRUGetOrLoadRacingRemove(t *testing.T) {
+	c := NewLRU[string, int](2)
+
+	// the record is edited (and its key removed) while the old version is being loaded
+	got, err := c.GetOrLoad("chirp", func() (int, error) {
+		c.Remove("chirp")
+		return 1, nil
+	})
+	if err != nil || got != 1 {
+		t.Errorf("expected 1 and no error, got: %v and %v", got, err)
+	}
+	if _, ok := c.Get("chirp"); ok {
+		t.Errorf("expected a load that raced a Remove not to be cached")
+	}
+
+	// same for Clear
+	c.GetOrLoad("chirp", func() (int, error) {
+		c.Clear()
+		return 1, nil
+	})
+	if _, ok := c.Get("chirp"); ok {
+		t.Errorf("expected a load that raced a Clear not to be cached")
+	}
+
+	// and with nothing in the way, it's cached as usual
+	c.GetOrLoad("chirp", func() (int, error) { return 2, nil })
+	if v, ok := c.Get("chirp"); !ok || v != 2 {
+		t.Errorf("expected chirp=2 to be cached, got %v, %v", v, ok)
+	}
+}
@@ -7,27 +7,71 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirps = `-- name: CountChirps :one
+SELECT COUNT(*)
+    FROM chirps
+`
+
+func (q *Queries) CountChirps(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirps)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countVisibleChirps = `-- name: CountVisibleChirps :one
+SELECT COUNT(*)
+    FROM chirps
+    WHERE status = 'published' AND (visibility = 'public' OR user_id = $1)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+`
+
+func (q *Queries) CountVisibleChirps(ctx context.Context, viewerID uuid.NullUUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countVisibleChirps, viewerID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (body, user_id)
+INSERT INTO chirps (body, user_id, visibility, lang, status, media_url)
 VALUES (
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
 )
 
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	Visibility ChirpVisibility
+	Lang       sql.NullString
+	Status     ChirpStatus
+	MediaUrl   sql.NullString
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.Visibility,
+		arg.Lang,
+		arg.Status,
+		arg.MediaUrl,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -35,12 +79,55 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
 	)
 	return i, err
 }
 
+const deleteChirp = `-- name: DeleteChirp :exec
+DELETE FROM chirps
+    WHERE id = $1
+`
+
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirp, id)
+	return err
+}
+
+const deleteChirpsByUser = `-- name: DeleteChirpsByUser :many
+DELETE FROM chirps
+    WHERE user_id = $1
+RETURNING id
+`
+
+func (q *Queries) DeleteChirpsByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, deleteChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpByChirpUUID = `-- name: GetChirpByChirpUUID :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
     FROM chirps
     WHERE ID = $1
 `
@@ -54,18 +141,575 @@ func (q *Queries) GetChirpByChirpUUID(ctx context.Context, id uuid.UUID) (Chirp,
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
+const getChirpForUpdate = `-- name: GetChirpForUpdate :one
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE id = $1
+    FOR UPDATE
+`
+
+// locks the row until the transaction ends, so checks made on it still hold when it's updated
+func (q *Queries) GetChirpForUpdate(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForUpdate, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = $1)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND ($2::text IS NULL OR lang = $2::text)
+        AND ($3::uuid IS NULL OR user_id = $3::uuid)
+        AND ($4::text IS NULL OR body ILIKE $4::text)
+    ORDER BY created_at ASC
+`
+
+type GetChirpsParams struct {
+	ViewerID    uuid.NullUUID
+	Lang        sql.NullString
+	AuthorID    uuid.NullUUID
+	BodyPattern sql.NullString
+}
+
+// oldest first. Every filter is optional (NULL skips it). body_pattern is an ILIKE pattern, so escape % and _ in what users type.
+func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps,
+		arg.ViewerID,
+		arg.Lang,
+		arg.AuthorID,
+		arg.BodyPattern,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsAfterCursor = `-- name: GetChirpsAfterCursor :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = $1)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND ($2::text IS NULL OR lang = $2::text)
+        AND ($3::uuid IS NULL OR user_id = $3::uuid)
+        AND ($4::text IS NULL OR body ILIKE $4::text)
+        AND ($5::timestamp IS NULL
+            OR (created_at, id) > ($5::timestamp, $6::uuid))
+    ORDER BY created_at ASC, id ASC
+    LIMIT $7
+`
+
+type GetChirpsAfterCursorParams struct {
+	ViewerID        uuid.NullUUID
+	Lang            sql.NullString
+	AuthorID        uuid.NullUUID
+	BodyPattern     sql.NullString
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// one page at a time, oldest first: everything strictly after the (created_at, id) cursor, or from the very
+// start when there's no cursor. id breaks ties between chirps created at the same moment. Filters work like GetChirps'.
+func (q *Queries) GetChirpsAfterCursor(ctx context.Context, arg GetChirpsAfterCursorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsAfterCursor,
+		arg.ViewerID,
+		arg.Lang,
+		arg.AuthorID,
+		arg.BodyPattern,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsBeforeCursor = `-- name: GetChirpsBeforeCursor :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
     FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = $1)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND ($2::text IS NULL OR lang = $2::text)
+        AND ($3::uuid IS NULL OR user_id = $3::uuid)
+        AND ($4::text IS NULL OR body ILIKE $4::text)
+        AND ($5::timestamp IS NULL
+            OR (created_at, id) < ($5::timestamp, $6::uuid))
+    ORDER BY created_at DESC, id DESC
+    LIMIT $7
+`
+
+type GetChirpsBeforeCursorParams struct {
+	ViewerID        uuid.NullUUID
+	Lang            sql.NullString
+	AuthorID        uuid.NullUUID
+	BodyPattern     sql.NullString
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// GetChirpsAfterCursor newest first: everything strictly before the cursor.
+func (q *Queries) GetChirpsBeforeCursor(ctx context.Context, arg GetChirpsBeforeCursorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsBeforeCursor,
+		arg.ViewerID,
+		arg.Lang,
+		arg.AuthorID,
+		arg.BodyPattern,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE id = ANY($1::uuid[])
+        AND status = 'published'
+        AND (visibility = 'public' OR user_id = $2)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
     ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsByIDsParams struct {
+	Ids      []uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, arg GetChirpsByIDsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(arg.Ids), arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsNewestFirst = `-- name: GetChirpsNewestFirst :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = $1)
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND ($2::text IS NULL OR lang = $2::text)
+        AND ($3::uuid IS NULL OR user_id = $3::uuid)
+        AND ($4::text IS NULL OR body ILIKE $4::text)
+    ORDER BY created_at DESC
+`
+
+type GetChirpsNewestFirstParams struct {
+	ViewerID    uuid.NullUUID
+	Lang        sql.NullString
+	AuthorID    uuid.NullUUID
+	BodyPattern sql.NullString
+}
+
+// GetChirps the other way round. Each order is its own query, rather than one ORDER BY CASE, so that
+// both can read chirps_created_at_id_idx in order instead of sorting every chirp.
+func (q *Queries) GetChirpsNewestFirst(ctx context.Context, arg GetChirpsNewestFirstParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsNewestFirst,
+		arg.ViewerID,
+		arg.Lang,
+		arg.AuthorID,
+		arg.BodyPattern,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNewestChirpTimestamp = `-- name: GetNewestChirpTimestamp :one
+SELECT GREATEST(
+        (SELECT MAX(updated_at) FROM chirps),
+        (SELECT changed_at FROM chirp_list_changes)
+    )::timestamp AS newest
+`
+
+// the last time GET /api/chirps could have changed: an edit, or a chirp leaving or joining it (see TouchChirpList)
+func (q *Queries) GetNewestChirpTimestamp(ctx context.Context) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getNewestChirpTimestamp)
+	var newest sql.NullTime
+	err := row.Scan(&newest)
+	return newest, err
+}
+
+const getRandomChirps = `-- name: GetRandomChirps :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE status = 'published' AND visibility = 'public'
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND ($1::uuid IS NULL OR user_id <> $1::uuid)
+    ORDER BY random()
+    LIMIT $2
+`
+
+type GetRandomChirpsParams struct {
+	ExcludeUserID uuid.NullUUID
+	Count         int32
+}
+
+// public chirps only (it's for discovering people), optionally leaving out one user's own.
+// ORDER BY random() sorts the whole table, which is fine at our size; revisit with TABLESAMPLE if it isn't.
+func (q *Queries) GetRandomChirps(ctx context.Context, arg GetRandomChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getRandomChirps, arg.ExcludeUserID, arg.Count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentIdenticalChirp = `-- name: GetRecentIdenticalChirp :one
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE user_id = $1
+        AND body = $2
+        AND visibility = $3
+        AND status = $4
+        AND lang IS NOT DISTINCT FROM $5
+        AND media_url IS NOT DISTINCT FROM $6
+        AND created_at >= $7
+    ORDER BY created_at DESC
+    LIMIT 1
+`
+
+type GetRecentIdenticalChirpParams struct {
+	UserID     uuid.UUID
+	Body       string
+	Visibility ChirpVisibility
+	Status     ChirpStatus
+	Lang       sql.NullString
+	MediaUrl   sql.NullString
+	Since      time.Time
+}
+
+// the newest chirp the user already posted with this body (as stored, so after censoring), visibility,
+// status, language and media since the given time. Finds double-posts; no row means it isn't one.
+func (q *Queries) GetRecentIdenticalChirp(ctx context.Context, arg GetRecentIdenticalChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRecentIdenticalChirp,
+		arg.UserID,
+		arg.Body,
+		arg.Visibility,
+		arg.Status,
+		arg.Lang,
+		arg.MediaUrl,
+		arg.Since,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
+const publishChirp = `-- name: PublishChirp :one
+UPDATE chirps
+    SET status = 'published',
+        created_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1 AND status = 'draft'
+RETURNING id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+`
+
+// created_at moves to publish time, so a draft written last week doesn't appear a week down the timeline.
+// No row if it's already published.
+func (q *Queries) PublishChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, publishChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
+const touchChirpList = `-- name: TouchChirpList :exec
+UPDATE chirp_list_changes
+    SET changed_at = NOW()
+`
+
+// for changes to the list that don't touch a chirp's updated_at: deletes, and accounts being (de|re)activated.
+// Run it in the same transaction, so no one can see the change with the old Last-Modified.
+func (q *Queries) TouchChirpList(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, touchChirpList)
+	return err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+    SET body = COALESCE($1, body),
+        visibility = COALESCE($2, visibility),
+        media_url = CASE WHEN $3::bool THEN $4 ELSE media_url END,
+        updated_at = NOW()
+    WHERE id = $5
+RETURNING id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+`
+
+type UpdateChirpParams struct {
+	Body        sql.NullString
+	Visibility  NullChirpVisibility
+	SetMediaUrl bool
+	MediaUrl    sql.NullString
+	ID          uuid.UUID
+}
+
+// a NULL body or visibility keeps the current one; media_url is only touched when set_media_url is true
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp,
+		arg.Body,
+		arg.Visibility,
+		arg.SetMediaUrl,
+		arg.MediaUrl,
+		arg.ID,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.Visibility,
+		&i.Lang,
+		&i.Status,
+		&i.MediaUrl,
+	)
+	return i, err
+}
+
+const userChirpStats = `-- name: UserChirpStats :one
+SELECT
+    COUNT(*) AS total_chirps,
+    COALESCE(AVG(LENGTH(body)), 0)::float8 AS average_length,
+    MAX(created_at)::timestamp AS latest_chirp_at
+    FROM chirps
+    WHERE user_id = $1 AND status = 'published' AND visibility = 'public'
+`
+
+type UserChirpStatsRow struct {
+	TotalChirps   int64
+	AverageLength float64
+	LatestChirpAt sql.NullTime
+}
+
+// what anyone can see of a user's chirps: public and published, like GET /api/chirps shows a logged-out visitor
+func (q *Queries) UserChirpStats(ctx context.Context, userID uuid.UUID) (UserChirpStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, userChirpStats, userID)
+	var i UserChirpStatsRow
+	err := row.Scan(&i.TotalChirps, &i.AverageLength, &i.LatestChirpAt)
+	return i, err
+}
+
+const getChirpsAfterID = `-- name: GetChirpsAfterID :many
+SELECT id, created_at, updated_at, body, user_id, visibility, lang, status, media_url
+    FROM chirps
+    WHERE id > $1
+    ORDER BY id ASC
+    LIMIT $2
+`
+
+type GetChirpsAfterIDParams struct {
+	ID    uuid.UUID
+	Limit int32
+}
+
+func (q *Queries) GetChirpsAfterID(ctx context.Context, arg GetChirpsAfterIDParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsAfterID, arg.ID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +723,10 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Visibility,
+			&i.Lang,
+			&i.Status,
+			&i.MediaUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -92,3 +740,23 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const replaceChirpBody = `-- name: ReplaceChirpBody :execrows
+UPDATE chirps
+    SET body = $1, updated_at = NOW()
+    WHERE id = $2 AND body = $3
+`
+
+type ReplaceChirpBodyParams struct {
+	NewBody string
+	ID      uuid.UUID
+	OldBody string
+}
+
+func (q *Queries) ReplaceChirpBody(ctx context.Context, arg ReplaceChirpBodyParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, replaceChirpBody, arg.NewBody, arg.ID, arg.OldBody)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
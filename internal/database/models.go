@@ -5,17 +5,152 @@
 package database
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ChirpStatus string
+
+const (
+	ChirpStatusDraft     ChirpStatus = "draft"
+	ChirpStatusPublished ChirpStatus = "published"
+)
+
+func (e *ChirpStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ChirpStatus(s)
+	case string:
+		*e = ChirpStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ChirpStatus: %T", src)
+	}
+	return nil
+}
+
+type NullChirpStatus struct {
+	ChirpStatus ChirpStatus
+	Valid       bool // Valid is true if ChirpStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullChirpStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.ChirpStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ChirpStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullChirpStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ChirpStatus), nil
+}
+
+type ChirpVisibility string
+
+const (
+	ChirpVisibilityPublic    ChirpVisibility = "public"
+	ChirpVisibilityPrivate   ChirpVisibility = "private"
+	ChirpVisibilityFollowers ChirpVisibility = "followers"
+)
+
+func (e *ChirpVisibility) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ChirpVisibility(s)
+	case string:
+		*e = ChirpVisibility(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ChirpVisibility: %T", src)
+	}
+	return nil
+}
+
+type NullChirpVisibility struct {
+	ChirpVisibility ChirpVisibility
+	Valid           bool // Valid is true if ChirpVisibility is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullChirpVisibility) Scan(value interface{}) error {
+	if value == nil {
+		ns.ChirpVisibility, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ChirpVisibility.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullChirpVisibility) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ChirpVisibility), nil
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	Visibility ChirpVisibility
+	Lang       sql.NullString
+	Status     ChirpStatus
+	MediaUrl   sql.NullString
+}
+
+type ChirpLink struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+	ChirpID   uuid.UUID
+	Url       string
+}
+
+type ChirpListChange struct {
+	ChangedAt time.Time
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+}
+
+type ChirpRevision struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ChirpID   uuid.UUID
 	Body      string
+}
+
+type EmailChange struct {
 	UserID    uuid.UUID
+	CreatedAt time.Time
+	NewEmail  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type ServiceAccount struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	Name       string
+	SecretHash string
+	Scopes     []string
 }
 
 type User struct {
@@ -24,4 +159,14 @@ type User struct {
 	UpdatedAt      time.Time
 	Email          string
 	HashedPassword string
+	IsAdmin        bool
+	PinnedChirpID  uuid.NullUUID
+	DeactivatedAt  sql.NullTime
+	LastSeenAt     sql.NullTime
+}
+
+type UserSetting struct {
+	UserID    uuid.UUID
+	Settings  json.RawMessage
+	UpdatedAt time.Time
 }
@@ -7,8 +7,24 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
 )
 
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*)
+    FROM users
+`
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, hashed_password)
 VALUES (
@@ -16,7 +32,7 @@ VALUES (
     $2
  
 )
-RETURNING id, created_at, updated_at, email, hashed_password
+RETURNING id, created_at, updated_at, email, hashed_password, is_admin, pinned_chirp_id, deactivated_at, last_seen_at
 `
 
 type CreateUserParams struct {
@@ -33,12 +49,45 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.PinnedChirpID,
+		&i.DeactivatedAt,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
+const deactivateUser = `-- name: DeactivateUser :execrows
+UPDATE users
+    SET deactivated_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1 AND deactivated_at IS NULL
+`
+
+// only touches an active account, so deactivating twice doesn't push back the purge.
+func (q *Queries) DeactivateUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deactivateUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const emailExists = `-- name: EmailExists :one
+SELECT EXISTS (
+    SELECT 1 FROM users WHERE email = $1
+)
+`
+
+func (q *Queries) EmailExists(ctx context.Context, email string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, emailExists, email)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password 
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, pinned_chirp_id, deactivated_at, last_seen_at 
     FROM users
     WHERE email = $1
 `
@@ -52,10 +101,79 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.PinnedChirpID,
+		&i.DeactivatedAt,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, pinned_chirp_id, deactivated_at, last_seen_at
+    FROM users
+    WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.PinnedChirpID,
+		&i.DeactivatedAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const promoteAdmin = `-- name: PromoteAdmin :execrows
+UPDATE users
+    SET is_admin = TRUE,
+        updated_at = NOW()
+    WHERE email = $1 AND NOT is_admin
+`
+
+// how the first admin gets made (ADMIN_EMAIL, see promoteAdmin): nothing in the API can set is_admin.
+func (q *Queries) PromoteAdmin(ctx context.Context, email string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, promoteAdmin, email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeDeactivatedUsers = `-- name: PurgeDeactivatedUsers :execrows
+DELETE FROM users
+    WHERE deactivated_at < $1::timestamp
+`
+
+// for good: their chirps and everything else of theirs go too (ON DELETE CASCADE).
+func (q *Queries) PurgeDeactivatedUsers(ctx context.Context, deactivatedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeactivatedUsers, deactivatedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const reactivateUser = `-- name: ReactivateUser :exec
+UPDATE users
+    SET deactivated_at = NULL,
+        updated_at = NOW()
+    WHERE id = $1
+`
+
+func (q *Queries) ReactivateUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, reactivateUser, id)
+	return err
+}
+
 const reset = `-- name: Reset :exec
 DELETE FROM users
 `
@@ -64,3 +182,78 @@ func (q *Queries) Reset(ctx context.Context) error {
 	_, err := q.db.ExecContext(ctx, reset)
 	return err
 }
+
+const setPinnedChirp = `-- name: SetPinnedChirp :one
+UPDATE users
+    SET pinned_chirp_id = $1,
+        updated_at = NOW()
+    WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_admin, pinned_chirp_id, deactivated_at, last_seen_at
+`
+
+type SetPinnedChirpParams struct {
+	PinnedChirpID uuid.NullUUID
+	ID            uuid.UUID
+}
+
+func (q *Queries) SetPinnedChirp(ctx context.Context, arg SetPinnedChirpParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPinnedChirp, arg.PinnedChirpID, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.PinnedChirpID,
+		&i.DeactivatedAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const touchUserLastSeen = `-- name: TouchUserLastSeen :exec
+UPDATE users
+    SET last_seen_at = NOW()
+    WHERE id = $1 AND (last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL '1 minute')
+`
+
+// at most once a minute per user, even with several instances each keeping their own lastSeenTracker.
+// updated_at is left alone: being seen isn't an edit.
+func (q *Queries) TouchUserLastSeen(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchUserLastSeen, id)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+    SET email = COALESCE($1, email),
+        hashed_password = COALESCE($2, hashed_password),
+        updated_at = NOW()
+    WHERE id = $3
+RETURNING id, created_at, updated_at, email, hashed_password, is_admin, pinned_chirp_id, deactivated_at, last_seen_at
+`
+
+type UpdateUserParams struct {
+	Email          sql.NullString
+	HashedPassword sql.NullString
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.PinnedChirpID,
+		&i.DeactivatedAt,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
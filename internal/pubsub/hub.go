@@ -0,0 +1,65 @@
+package pubsub
+
+import "sync"
+
+// Hub fans messages out to any number of subscribers, and is safe to share between goroutines.
+//
+// Publish never blocks: each subscriber has a small buffer, and a subscriber that falls behind
+// (its buffer is full) simply misses that message. One slow client mustn't hold up everyone else.
+type Hub[T any] struct {
+	mu          sync.Mutex
+	subscribers map[chan T]struct{}
+	bufferSize  int
+}
+
+// NewHub makes a hub whose subscriber channels buffer up to bufferSize messages each.
+func NewHub[T any](bufferSize int) *Hub[T] {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &Hub[T]{
+		subscribers: make(map[chan T]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscribe returns a channel that receives every message published from now on, and a function
+// that unsubscribes (and closes the channel). Always call unsubscribe when you're done, or the hub
+// keeps the channel forever. Calling it more than once is fine.
+func (h *Hub[T]) Subscribe() (<-chan T, func()) {
+	ch := make(chan T, h.bufferSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Publish sends msg to every current subscriber that has room for it.
+func (h *Hub[T]) Publish(msg T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- msg:
+		default: // this subscriber's buffer is full - drop it for them rather than block
+		}
+	}
+}
+
+// Len reports how many subscribers there are right now.
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
@@ -0,0 +1,46 @@
+package pubsub
+
+import "testing"
+
+func TestHubPublishSubscribe(t *testing.T) {
+	h := NewHub[int](2)
+
+	first, unsubscribeFirst := h.Subscribe()
+	second, unsubscribeSecond := h.Subscribe()
+	defer unsubscribeSecond()
+
+	h.Publish(1)
+	if got := <-first; got != 1 {
+		t.Errorf("first subscriber: expected: 1, got: %v", got)
+	}
+	if got := <-second; got != 1 {
+		t.Errorf("second subscriber: expected: 1, got: %v", got)
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst() // twice is harmless
+	if _, ok := <-first; ok {
+		t.Errorf("expected channel to be closed after unsubscribe")
+	}
+	if h.Len() != 1 {
+		t.Errorf("expected 1 subscriber, got: %v", h.Len())
+	}
+}
+
+func TestHubDropsForSlowSubscriber(t *testing.T) {
+	h := NewHub[int](1)
+	ch, unsubscribe := h.Subscribe()
+	defer unsubscribe()
+
+	h.Publish(1)
+	h.Publish(2) // buffer is full, so this must not block
+
+	if got := <-ch; got != 1 {
+		t.Errorf("expected: 1, got: %v", got)
+	}
+	select {
+	case got := <-ch:
+		t.Errorf("expected the second message to be dropped, got: %v", got)
+	default:
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+)
+
+type IntrospectRequest struct {
+	Token string `json:"token"`
+}
+
+// IntrospectResponse loosely follows RFC 7662: for anything that isn't a valid token, it's just {"active": false}.
+type IntrospectResponse struct {
+	Active bool   `json:"active"`
+	Sub    string `json:"sub,omitempty"` // user ID
+	Exp    int64  `json:"exp,omitempty"` // unix seconds
+	Iat    int64  `json:"iat,omitempty"` // unix seconds
+}
+
+// POST /api/introspect - lets other services check a user's access token without knowing the signing secret.
+// Callers authenticate with the API key (see middlewareRequireAPIKey). Why a token isn't valid (expired,
+// bad signature, wrong audience...) is never said - the answer is just inactive.
+func (cfg *apiConfig) middlewareMetricsIntrospect(w http.ResponseWriter, req *http.Request) {
+	params := IntrospectRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+	if params.Token == "" {
+		respondWithError(w, 400, errCodeBadRequest, "token is required")
+		return
+	}
+
+	info, err := cfg.validateAccessToken(params.Token)
+	if err != nil {
+		jsonWriter(w, 200, IntrospectResponse{Active: false})
+		return
+	}
+
+	resp := IntrospectResponse{
+		Active: true,
+		Sub:    info.UserID.String(),
+	}
+	if !info.ExpiresAt.IsZero() {
+		resp.Exp = info.ExpiresAt.Unix()
+	}
+	if !info.IssuedAt.IsZero() {
+		resp.Iat = info.IssuedAt.Unix()
+	}
+	jsonWriter(w, 200, resp)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// chirpLanguages are the ISO 639-1 codes a chirp can be tagged with. It's deliberately short -
+// add to it when someone actually posts in a language that's missing.
+var chirpLanguages = map[string]bool{
+	"ar": true, "de": true, "en": true, "es": true, "fr": true, "hi": true, "it": true,
+	"ja": true, "ko": true, "nl": true, "pl": true, "pt": true, "ru": true, "sv": true,
+	"tr": true, "uk": true, "zh": true,
+}
+
+var errUnknownLanguage = errors.New("lang must be a supported ISO 639-1 code, like \"en\"")
+
+// parseLang checks a lang from a request (case-insensitive, so "EN" is fine) and returns it ready
+// to store. Empty means the chirp's language isn't known, which is stored as NULL - we don't try to detect it.
+func parseLang(lang string) (sql.NullString, error) {
+	if lang == "" {
+		return sql.NullString{}, nil
+	}
+	lang = strings.ToLower(lang)
+	if !chirpLanguages[lang] {
+		return sql.NullString{}, errUnknownLanguage
+	}
+	return sql.NullString{String: lang, Valid: true}, nil
+}
+
+// chirpLang is the Chirp.Lang for a stored lang: nil when it isn't known
+func chirpLang(lang sql.NullString) *string {
+	if !lang.Valid {
+		return nil
+	}
+	return &lang.String
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lastSeenInterval is how stale users.last_seen_at is allowed to get. Writing it on every request would
+// turn every read into a write too; once a minute is plenty for "online now" / "seen 5 minutes ago".
+// TouchUserLastSeen has the same minute written into it.
+const lastSeenInterval = time.Minute
+
+// lastSeenTracker remembers when we last wrote each user's last_seen_at, so most requests don't even
+// try. Like sessionDenylist it's per instance; the query itself skips rows written within the interval,
+// so a few instances between them still only write about once a minute per user.
+type lastSeenTracker struct {
+	mu       sync.Mutex
+	lastSeen map[uuid.UUID]time.Time
+	interval time.Duration
+}
+
+func newLastSeenTracker(interval time.Duration) *lastSeenTracker {
+	return &lastSeenTracker{lastSeen: make(map[uuid.UUID]time.Time), interval: interval}
+}
+
+// due reports whether userID's last_seen_at needs writing at now, and if so counts it as written
+func (t *lastSeenTracker) due(userID uuid.UUID, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.lastSeen[userID]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+	t.prune(now)
+	t.lastSeen[userID] = now
+	return true
+}
+
+// prune drops users we haven't written for in a while, so the map only holds recently active ones. Caller holds mu.
+func (t *lastSeenTracker) prune(now time.Time) {
+	for userID, last := range t.lastSeen {
+		if now.Sub(last) >= t.interval {
+			delete(t.lastSeen, userID)
+		}
+	}
+}
+
+// sawUser records that userID just made an authenticated request. The write happens in the background
+// and never holds up (or fails) the request; if it doesn't make it, the next one a minute later will.
+// With no tracker (as in most tests) it does nothing.
+func (cfg *apiConfig) sawUser(userID uuid.UUID) {
+	if cfg.lastSeen == nil || !cfg.lastSeen.due(userID, time.Now()) {
+		return
+	}
+
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		ctx, cancel := cfg.dbContext(context.Background()) // not the request's: it may be over before this runs
+		defer cancel()
+		err := cfg.db.TouchUserLastSeen(ctx, userID)
+		if err != nil {
+			slog.Warn("error updating last seen", "user_id", userID, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlPattern finds things that look like links in a chirp body. It's deliberately loose -
+// extractLinks does the real checking with url.Parse.
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// extractLinks returns the distinct http/https URLs in body, in the order they first appear.
+// Anything that doesn't parse as a proper URL (or has no host) is skipped rather than treated as an error.
+func extractLinks(body string) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	for _, match := range urlPattern.FindAllString(body, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}'") // "see https://example.com." - the dot ends the sentence, not the link
+
+		parsed, err := url.Parse(match)
+		if err != nil {
+			continue
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" { // url.Parse lowercases the scheme for us
+			continue
+		}
+
+		parsed.Host = strings.ToLower(parsed.Host) // hosts are case-insensitive, so Example.com and example.com are the same link
+		link := parsed.String()
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"no links here", nil},
+		{"see https://example.com.", []string{"https://example.com"}},
+		{"HTTP://Example.com/a?b=c and http://example.com/a?b=c", []string{"http://example.com/a?b=c"}},
+		{"twice https://a.dev https://a.dev, then (http://b.dev/x)", []string{"https://a.dev", "http://b.dev/x"}},
+		{"ftp://files.example.com and javascript:alert(1) and http:// alone", nil},
+		{"broken http://[::1 but fine https://ok.example", []string{"https://ok.example"}},
+	}
+
+	for _, c := range cases {
+		got := extractLinks(c.body)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("body %q: expected: %v, got: %v", c.body, c.want, got)
+		}
+	}
+}
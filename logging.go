@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// newLogger builds the app's structured logger.
+// level is one of debug/info/warn/error (default info), format is text or json (default text).
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		slogLevel = slog.LevelDebug
+	case "", "info":
+		slogLevel = slog.LevelInfo
+	case "warn", "warning":
+		slogLevel = slog.LevelWarn
+	case "error":
+		slogLevel = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", level)
+	}
+
+	options := &slog.HandlerOptions{Level: slogLevel}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+}
+
+// logRequestError logs a handler failure at error level, tagged with the request's method, path and ID.
+// Extra key/value pairs (like "user_id", userID) can be passed in args.
+func logRequestError(req *http.Request, msg string, err error, args ...any) {
+	attrs := []any{
+		"method", req.Method,
+		"path", req.URL.Path,
+		"request_id", requestIDFromContext(req.Context()),
+		"error", err,
+	}
+	slog.ErrorContext(req.Context(), msg, append(attrs, args...)...)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	logger.Info("should be dropped")
+	logger.Warn("should be kept", "user_id", "abc")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 log line, got: %v", lines)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected json log line, got: %v", lines[0])
+	}
+	if entry["msg"] != "should be kept" || entry["user_id"] != "abc" {
+		t.Errorf("unexpected log entry: %v", entry)
+	}
+
+	if _, err := newLogger(&buf, "loud", "text"); err == nil {
+		t.Errorf("expected error for unknown level, got none")
+	}
+	if _, err := newLogger(&buf, "info", "xml"); err == nil {
+		t.Errorf("expected error for unknown format, got none")
+	}
+}
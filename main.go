@@ -4,47 +4,188 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gainax2k1/chirpy/internal/cache"
 	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/gainax2k1/chirpy/internal/pubsub"
 	"github.com/google/uuid"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+// Build information, injected at build time via -ldflags, e.g.:
+// go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
 )
 
 type apiConfig struct {
-	db             *database.Queries
+	db             database.Querier // interface (not *database.Queries) so tests can swap in a mock
+	sqlDB          *sql.DB          // the connection behind db, for transactions (see withTx); nil in tests
 	fileserverHits atomic.Int32
 	/*
 		The atomic.Int32 type is a really cool standard-library type that allows us
 		to safely increment and read an integer value across multiple goroutines
 		(HTTP requests).
 	*/
+	staticMaxAge time.Duration // how long browsers may cache /app/ and /assets/ files other than HTML (STATIC_MAX_AGE)
+
 	platform string
-	secret   string
+	jwtKeys  auth.KeySet // signs new tokens with the primary key, still accepts tokens from previous ones
+
+	passwordAlgorithm auth.PasswordAlgorithm // for new hashes only; logins check whichever kind is stored
+	breachChecker     *auth.BreachChecker    // rejects breached passwords when set (CHECK_BREACHED_PASSWORDS=true)
+	audience          string                 // JWT "aud" claim for this deployment's client; empty means tokens aren't audience-scoped
+
+	introspectionAPIKey string // what other services send to POST /api/introspect; empty switches it off
+
+	adminEmail string // the account warmUp makes an admin (ADMIN_EMAIL), see promoteAdmin; empty leaves admins alone
+
+	chirpCache *cache.LRU[uuid.UUID, database.Chirp] // single-chirp reads; remember to Remove() on edit/delete!
+	chirpHub   *pubsub.Hub[Chirp]                    // every new chirp is published here, for live streams (GET /api/ws)
+
+	maxChirpLength  int            // in bytes, same as len()
+	filterProfanity bool           // false stores chirps exactly as written (FILTER_PROFANITY=false)
+	profanityStyle  profanityStyle // how banned words get censored
+	profanityMatch  profanityMatch // whole words only, or inside other words too (PROFANITY_MATCH)
+	moderator       ChirpModerator // can refuse a chirp outright (CHIRP_MODERATOR); allowAllModerator by default
+
+	chirpDedupeWindow time.Duration // a user posting the same chirp again this soon gets the first one back (CHIRP_DEDUPE_SECONDS); 0 is off
+
+	maintenance atomic.Int32 // a maintenanceMode, flipped at runtime via POST /admin/maintenance
+
+	dbTimeout      time.Duration // how long any single database call gets (see dbContext)
+	dbRetry        retryPolicy   // how read queries retry transient errors (see withRetry)
+	dbMaxOpenConns int           // the connection pool's cap (DB_MAX_OPEN_CONNS); 0 is no limit. See isPoolExhausted
+
+	authCookieName   string // cookie login sets (when asked to) and middlewareAuth falls back to
+	authCookieSecure bool   // only turn off for local development over plain http
+
+	accessTokenTTL time.Duration // longest an access token from login lasts, and its default (ACCESS_TOKEN_TTL)
+
+	deactivationGrace time.Duration // how long after DELETE /api/users logging in undoes it (USER_DEACTIVATION_GRACE)
+
+	lastSeen   *lastSeenTracker // throttles users.last_seen_at writes (see sawUser); nil doesn't write them at all
+	background sync.WaitGroup   // fire-and-forget work still running, waited for on shutdown
+
+	revokedSessions *sessionDenylist // users an admin has logged out (POST /admin/users/{userID}/revoke)
+
+	emailCheckLimiter *rateLimiter // per client IP, for GET /api/users/available
+
+	trustedProxies []netip.Prefix // load balancers etc. whose X-Forwarded-For we believe (see clientIP)
+
+	corsRules []corsRule // which origins may call which routes from a browser (see middlewareCORS)
+
+	startedAt time.Time              // for the uptime in GET /api/healthz
+	ready     atomic.Bool            // set by warmUp once we can take traffic (GET /api/readyz)
+	dbVersion atomic.Pointer[string] // postgres version() once we've asked (see databaseVersion)
+
+	metrics *metrics // Prometheus counters and histograms, scraped from GET /metrics
 }
 
+const defaultChirpCacheSize = 1000
+
+const chirpHubBufferSize = 16 // per subscriber; a client further behind than this misses chirps
+
+const defaultMaxChirpLength = 140
+
+const defaultDBTimeoutSeconds = 5
+
+const defaultAuthCookieName = "chirpy_token"
+
+// GET /api/users/available tells anyone whether an email has an account, so it's limited per client IP
+// to keep it from being used to check a whole list of addresses
+const (
+	emailCheckLimit  = 10
+	emailCheckWindow = time.Minute
+)
+
+const (
+	defaultAccessTokenTTL = time.Hour
+	maxAccessTokenTTL     = 24 * time.Hour // past this, a leaked token is useful for too long
+)
+
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Email     string    `json:"email"`
-	Token     string    `json:"token"`
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     Timestamp  `json:"created_at"`
+	UpdatedAt     Timestamp  `json:"updated_at"`
+	Email         string     `json:"email"`
+	Token         string     `json:"token"`
+	PinnedChirpID *uuid.UUID `json:"pinned_chirp_id"` // null if nothing's pinned (see POST /api/me/pin)
 }
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  Timestamp `json:"created_at"`
+	UpdatedAt  Timestamp `json:"updated_at"`
+	Body       string    `json:"body"`
+	UserID     uuid.UUID `json:"user_id"`
+	Visibility string    `json:"visibility"`         // "public" or "private"
+	Lang       *string   `json:"lang"`               // ISO 639-1, null if the author didn't say
+	Status     string    `json:"status"`             // "published" or "draft"
+	MediaURL   *string   `json:"media_url"`          // an image or video hosted elsewhere, null if there isn't one
+	Filtered   bool      `json:"filtered,omitempty"` // only when creating: the profanity filter changed the body
+}
+
+// userFromDB is what we send for a database user: never the password hash, and no token (login adds that)
+func userFromDB(dbUser database.User) User {
+	return User{
+		ID:            dbUser.ID,
+		CreatedAt:     newTimestamp(dbUser.CreatedAt),
+		UpdatedAt:     newTimestamp(dbUser.UpdatedAt),
+		Email:         dbUser.Email,
+		PinnedChirpID: pinnedChirpID(dbUser),
+	}
+}
+
+// chirpFromDB is what we send for a database chirp. Handlers adjust the copy (inTimezone, Filtered) as needed.
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	return Chirp{
+		ID:         dbChirp.ID,
+		CreatedAt:  newTimestamp(dbChirp.CreatedAt),
+		UpdatedAt:  newTimestamp(dbChirp.UpdatedAt),
+		Body:       dbChirp.Body,
+		UserID:     dbChirp.UserID,
+		Visibility: string(dbChirp.Visibility),
+		Lang:       chirpLang(dbChirp.Lang),
+		Status:     string(dbChirp.Status),
+		MediaURL:   chirpMediaURL(dbChirp.MediaUrl),
+	}
+}
+
+type ChirpLink struct {
+	URL       string    `json:"url"`
+	CreatedAt Timestamp `json:"created_at"`
+}
+
+// ChirpRevision is an earlier version of an edited chirp; CreatedAt is when it was replaced
+type ChirpRevision struct {
 	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt Timestamp `json:"created_at"`
+}
+
+type EmailAvailability struct {
+	Available bool `json:"available"`
 }
 
 type CreateUserRequest struct {
@@ -53,49 +194,426 @@ type CreateUserRequest struct {
 	ExpireTime int    `json:"expires_in_seconds"`
 }
 
+// PatchUserRequest uses pointers so a field that's left out (nil) can be told apart from one sent empty
+type PatchUserRequest struct {
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+}
+
+type UpdateChirpRequest struct {
+	Body       *string `json:"body"`       // left out keeps the current one; can't be emptied
+	Visibility string  `json:"visibility"` // left out (empty) keeps the current one
+	MediaURL   *string `json:"media_url"`  // left out keeps the current one, "" removes it
+}
+
 type CreateChirp struct {
-	Body    string    `json:"body"`
-	User_ID uuid.UUID `json:"user_id"`
+	Body       string    `json:"body"`
+	User_ID    uuid.UUID `json:"user_id"`
+	Visibility string    `json:"visibility"` // defaults to public
+	Lang       string    `json:"lang"`       // optional ISO 639-1 code (see chirpLanguages)
+	Status     string    `json:"status"`     // "draft" to save without posting; defaults to published
+	MediaURL   string    `json:"media_url"`  // optional link to an image or video hosted elsewhere
+}
+
+type UserStats struct {
+	TotalChirps   int64      `json:"total_chirps"`
+	AverageLength float64    `json:"average_length"`
+	LatestChirpAt *Timestamp `json:"latest_chirp_at"` // null if they've never chirped
+	LastSeenAt    *Timestamp `json:"last_seen_at"`    // their last authenticated request, to the minute; null if never
+}
+
+type Health struct {
+	Status          string `json:"status"`
+	Version         string `json:"version,omitempty"` // this and the rest only on the dev platform
+	DatabaseVersion string `json:"database_version,omitempty"`
+	UptimeSeconds   int64  `json:"uptime_seconds,omitempty"`
+}
+
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+type DeletedChirps struct {
+	Deleted int `json:"deleted"`
+}
+
+type ResetDryRun struct {
+	DryRun bool  `json:"dry_run"`
+	Users  int64 `json:"users"`
+	Chirps int64 `json:"chirps"` // chirps are deleted along with their users (ON DELETE CASCADE)
 }
 
 type errResponse struct {
-	Error string `json:"error"`
+	Error  string            `json:"error"`            // human-readable message
+	Code   string            `json:"code,omitempty"`   // machine-readable, for clients to switch on
+	Fields map[string]string `json:"fields,omitempty"` // per-field messages, with code validation_failed (see fieldErrors)
+	Max    int               `json:"max,omitempty"`    // a too-long chirp: the limit, in bytes like CHIRP_MAX_LENGTH
+	Length int               `json:"length,omitempty"` // a too-long chirp: how long it actually was
 }
 
+// machine-readable error codes returned in errResponse.Code
+// (clients depend on these, so don't rename them once they're out there!)
+const (
+	errCodeBadRequest         = "bad_request"
+	errCodeInvalidJSON        = "invalid_json"
+	errCodeInvalidID          = "invalid_id"
+	errCodeUnauthorized       = "unauthorized"
+	errCodeForbidden          = "forbidden"
+	errCodeNotFound           = "not_found"
+	errCodeMethodNotAllowed   = "method_not_allowed"
+	errCodeEmailTaken         = "email_taken"
+	errCodeChirpTooLong       = "chirp_too_long"
+	errCodeInternal           = "internal_error"
+	errCodeConflict           = "precondition_failed"
+	errCodeMaintenance        = "maintenance"
+	errCodeDBTimeout          = "db_timeout"
+	errCodeDBBusy             = "db_busy"
+	errCodeValidation         = "validation_failed"
+	errCodeChirpRejected      = "chirp_rejected"
+	errCodeAlreadyPublished   = "already_published"
+	errCodeUnsupportedVersion = "unsupported_version"
+	errCodeRateLimited        = "rate_limited"
+	errCodeTooLarge           = "too_large"
+	errCodeNotReady           = "not_ready"
+)
+
 func main() {
+	seed := flag.Bool("seed", false, "insert sample users and chirps (dev platform only), print their tokens, and exit")
+	flag.Parse()
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	dbURL := os.Getenv("DB_URL")
+	// set up structured logging first, so everything after this goes through it
+	logger, err := newLogger(os.Stdout, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger) // also routes the plain "log" package through our handler
+
+	// Anything read with envSecret can be given as a file instead, e.g. SECRET_FILE=/run/secrets/chirpy_secret,
+	// to keep it out of the environment.
+	secrets := make(map[string]string)
+	for _, name := range []string{"DB_URL", "SECRET", "JWT_SECRET", "JWT_PREVIOUS_KEYS", "INTROSPECTION_API_KEY"} {
+		secrets[name], err = envSecret(name)
+		if err != nil {
+			slog.Error("invalid config", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	dbURL := secrets["DB_URL"]
 	platform := os.Getenv("PLATFORM")
-	secret := os.Getenv("SECRET")
+	secret := secrets["SECRET"]
+	audience := os.Getenv("JWT_AUDIENCE")
+
+	// To rotate SECRET: give the current one an ID in JWT_KEY_ID, move it into JWT_PREVIOUS_KEYS
+	// ("id:secret,..."), and set the new SECRET (with a new JWT_KEY_ID). Drop the old entry once
+	// its tokens have expired.
+	// Or, more simply, set JWT_SECRET instead of all three: "new,old" signs with new and accepts both,
+	// so prepend the new secret and remove the old one once its tokens have expired.
+	var jwtKeys auth.KeySet
+	if jwtSecrets := secrets["JWT_SECRET"]; jwtSecrets != "" {
+		if secret != "" || os.Getenv("JWT_KEY_ID") != "" || secrets["JWT_PREVIOUS_KEYS"] != "" {
+			slog.Error("set either JWT_SECRET or SECRET (with JWT_KEY_ID and JWT_PREVIOUS_KEYS), not both")
+			os.Exit(1)
+		}
+		jwtKeys, err = auth.ParseSecrets(jwtSecrets)
+		if err != nil {
+			slog.Error("invalid JWT_SECRET", "error", err)
+			os.Exit(1)
+		}
+	} else {
+		previousKeys, err := auth.ParseKeys(secrets["JWT_PREVIOUS_KEYS"])
+		if err != nil {
+			slog.Error("invalid JWT_PREVIOUS_KEYS", "error", err)
+			os.Exit(1)
+		}
+		jwtKeys = auth.KeySet{
+			Primary:  auth.Key{ID: os.Getenv("JWT_KEY_ID"), Secret: secret},
+			Previous: previousKeys,
+		}
+	}
+
+	introspectionAPIKey := secrets["INTROSPECTION_API_KEY"]
+
+	passwordAlgorithm, err := auth.ParsePasswordAlgorithm(os.Getenv("PASSWORD_ALGO"))
+	if err != nil {
+		slog.Error("invalid PASSWORD_ALGO", "error", err)
+		os.Exit(1)
+	}
+
+	// opt-in: it sends a prefix of each new password's SHA-1 to HaveIBeenPwned (see auth.BreachChecker)
+	checkBreachedPasswords, err := envBool("CHECK_BREACHED_PASSWORDS", false)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	var breachChecker *auth.BreachChecker
+	if checkBreachedPasswords {
+		breachChecker = &auth.BreachChecker{}
+	}
+
+	filterProfanityEnabled, err := envBool("FILTER_PROFANITY", true) // on unless explicitly turned off
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	profanityStyle, err := parseProfanityStyle(os.Getenv("PROFANITY_STYLE"))
+	if err != nil {
+		slog.Error("invalid PROFANITY_STYLE", "error", err)
+		os.Exit(1)
+	}
+
+	profanityMatch, err := parseProfanityMatch(os.Getenv("PROFANITY_MATCH"))
+	if err != nil {
+		slog.Error("invalid PROFANITY_MATCH", "error", err)
+		os.Exit(1)
+	}
+
+	// PROFANITY_FILE (one word per line, # comments) wins over PROFANITY_WORDS (comma-separated);
+	// with neither we use the built-in list. A SIGHUP re-reads the file.
+	profanityFile := os.Getenv("PROFANITY_FILE")
+	bannedWordList, err := loadProfanity(profanityFile, os.Getenv("PROFANITY_WORDS"))
+	if err != nil {
+		slog.Error("invalid profanity list", "error", err)
+		os.Exit(1)
+	}
+	setProfanity(bannedWordList)
+
+	moderator, err := parseChirpModerator(os.Getenv("CHIRP_MODERATOR"))
+	if err != nil {
+		slog.Error("invalid CHIRP_MODERATOR", "error", err)
+		os.Exit(1)
+	}
+
+	chirpCacheSize, err := envPositiveInt("CHIRP_CACHE_SIZE", defaultChirpCacheSize)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	maxChirpLength, err := envPositiveInt("CHIRP_MAX_LENGTH", defaultMaxChirpLength)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	// off by default: someone may well mean to say the same thing twice
+	chirpDedupeSeconds, err := envNonNegativeInt("CHIRP_DEDUPE_SECONDS", 0)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	dbTimeoutSeconds, err := envPositiveInt("DB_TIMEOUT_SECONDS", defaultDBTimeoutSeconds)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	authCookieName := os.Getenv("AUTH_COOKIE_NAME")
+	if authCookieName == "" {
+		authCookieName = defaultAuthCookieName
+	}
+	authCookieSecure, err := envBool("AUTH_COOKIE_SECURE", true)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	accessTokenTTL, err := envDuration("ACCESS_TOKEN_TTL", defaultAccessTokenTTL, maxAccessTokenTTL)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	deactivationGrace, err := envDuration("USER_DEACTIVATION_GRACE", defaultDeactivationGrace, maxDeactivationGrace)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	staticMaxAge, err := envDuration("STATIC_MAX_AGE", defaultStaticMaxAge, maxStaticMaxAge)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	dbMaxRetries, err := envNonNegativeInt("DB_MAX_RETRIES", defaultDBMaxRetries)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	dbMaxOpenConns, err := envNonNegativeInt("DB_MAX_OPEN_CONNS", 0)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+
+	// e.g. ADMIN_EMAIL=walt@graymatter.com: sign up with it, then (re)start the server to make that account an admin
+	adminEmail := os.Getenv("ADMIN_EMAIL")
+	if adminEmail != "" && !isValidEmail(adminEmail) {
+		slog.Error("invalid ADMIN_EMAIL", "admin_email", adminEmail)
+		os.Exit(1)
+	}
+
+	// e.g. TRUSTED_PROXIES=10.0.0.0/8 behind a load balancer on the private network. Leave it unset
+	// when clients connect directly, or anyone could pick their own IP with X-Forwarded-For.
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+
+	// our own frontends (e.g. CORS_ALLOWED_ORIGINS=https://chirpy.example.com), for the routes public reads don't cover
+	corsRules := newCORSRules(parseOrigins(os.Getenv("CORS_ALLOWED_ORIGINS")))
+
+	// with both set we serve HTTPS (and HTTP/2) ourselves; without them, plain HTTP for dev or behind a proxy
+	serverTLS, err := parseTLSFiles(os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY"))
+	if err != nil {
+		slog.Error("invalid TLS config", "error", err)
+		os.Exit(1)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		fmt.Println("error opening sql: ", err)
+		slog.Error("error opening sql", "error", err)
 		os.Exit(1)
 
 	}
 	defer db.Close()
+	// requests past the cap wait for a connection, and get 503 with Retry-After if none frees up in DB_TIMEOUT_SECONDS
+	db.SetMaxOpenConns(dbMaxOpenConns)
 
-	dbQueries := database.New(db)
+	migrateOnStartup := os.Getenv("MIGRATE_ON_STARTUP") == "true" // see warmUp
 
 	cfg := &apiConfig{
-		db:       dbQueries,
+		sqlDB:    db,
 		platform: platform,
-		secret:   secret,
+		jwtKeys:  jwtKeys,
+		audience: audience,
+
+		staticMaxAge: staticMaxAge,
+
+		introspectionAPIKey: introspectionAPIKey,
+
+		adminEmail: adminEmail,
+
+		passwordAlgorithm: passwordAlgorithm,
+		breachChecker:     breachChecker,
+
+		chirpCache: cache.NewLRU[uuid.UUID, database.Chirp](chirpCacheSize),
+		chirpHub:   pubsub.NewHub[Chirp](chirpHubBufferSize),
+
+		maxChirpLength:  maxChirpLength,
+		filterProfanity: filterProfanityEnabled,
+		profanityStyle:  profanityStyle,
+		profanityMatch:  profanityMatch,
+		moderator:       moderator,
+
+		chirpDedupeWindow: time.Duration(chirpDedupeSeconds) * time.Second,
+
+		dbTimeout:      time.Duration(dbTimeoutSeconds) * time.Second,
+		dbRetry:        retryPolicy{maxRetries: dbMaxRetries, baseDelay: defaultDBRetryDelay},
+		dbMaxOpenConns: dbMaxOpenConns,
+
+		authCookieName:   authCookieName,
+		authCookieSecure: authCookieSecure,
+
+		accessTokenTTL:  accessTokenTTL,
+		revokedSessions: newSessionDenylist(accessTokenTTL),
+
+		deactivationGrace: deactivationGrace,
+
+		lastSeen: newLastSeenTracker(lastSeenInterval),
+
+		emailCheckLimiter: newRateLimiter(emailCheckLimit, emailCheckWindow),
+
+		trustedProxies: trustedProxies,
+
+		corsRules: corsRules,
+
+		startedAt: time.Now(),
 	}
+	cfg.metrics = newMetrics(&cfg.fileserverHits)
+	cfg.db = database.New(cfg.metrics.instrumentDB(poolWaitDB{db})) // times every query for GET /metrics
 
-	// This creates a "multiplexer"—a router for incoming HTTP requests.
-	// It decides which handler should process requests for different URL paths.
-	mux := http.NewServeMux()
+	if *seed {
+		if cfg.platform != "dev" {
+			slog.Error("refusing to seed: PLATFORM must be \"dev\"", "platform", cfg.platform)
+			os.Exit(1)
+		}
+		err = cfg.warmUp(context.Background(), migrateOnStartup)
+		if err != nil {
+			slog.Error("error starting up", "error", err)
+			os.Exit(1)
+		}
+		err = cfg.seedDatabase(context.Background())
+		if err != nil {
+			slog.Error("error seeding database", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Actually makes the server that listens on port 8080 and uses the mux that was just created.
+	// Actually makes the server that listens on port 8080, using the mux built by routes().
 	newServer := http.Server{
 		Addr:    ":8080",
-		Handler: mux,
+		Handler: middlewareRequestID(cfg.middlewareClientIP(middlewareLogging(cfg.routes()))), // request ID and client IP first, so the logger can see them
+	}
+
+	slog.Info("configuration", cfg.configSummary(newServer.Addr, dbURL)...)
+
+	ln, err := net.Listen("tcp", newServer.Addr)
+	if err != nil {
+		slog.Error("error listening", "addr", newServer.Addr, "error", err)
+		os.Exit(1)
+	}
+
+	// starts your server and keeps it running, handling incoming HTTP requests as per your routing rules,
+	// until Ctrl-C or a SIGTERM (from docker stop, say) asks it to finish up and exit.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// GET /api/readyz answers 503 until this finishes
+	go func() {
+		if err := cfg.warmUp(ctx, migrateOnStartup); err != nil {
+			if ctx.Err() != nil {
+				return // shutting down before we ever got going
+			}
+			slog.Error("error starting up", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("server ready")
+		cfg.runPurge(ctx)
+	}()
+
+	if profanityFile != "" {
+		go reloadProfanityOnHangup(ctx, profanityFile)
+	}
+
+	slog.Info("server starting", "addr", newServer.Addr, "platform", cfg.platform, "tls", serverTLS.enabled())
+	err = serve(ctx, &newServer, ln, serverTLS)
+	cfg.background.Wait() // let last_seen_at writes and the like finish before the database closes
+	if err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("server stopped")
+}
+
+// routes registers every endpoint on a fresh mux. It's split out of main() so tests can build the exact same router.
+func (cfg *apiConfig) routes() http.Handler {
+	// This creates a "multiplexer"—a router for incoming HTTP requests.
+	// It decides which handler should process requests for different URL paths.
+	mux := http.NewServeMux()
 
 	// Tells tbe mux that any request starting with "/" should be handled by a fileserver serving from
 	// the current directory.
@@ -104,7 +622,7 @@ func main() {
 	// mux.Handle("/", http.FileServer(http.Dir(".")))
 	// after adding readiness():
 
-	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
+	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app/", middlewareStaticCache(http.Dir("."), cfg.staticMaxAge, http.FileServer(http.Dir("."))))))
 
 	// similar to above, but for URLs that start with "/assets"
 	// -- my initial, not-quite-there implimentation:
@@ -113,27 +631,58 @@ func main() {
 	//    WON'T be caught. The following is the robust version that handles it correctly
 
 	// suggested, more robust implimentation:
-	mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
+	mux.Handle("/assets/", http.StripPrefix("/assets/", middlewareStaticCache(http.Dir("./assets"), cfg.staticMaxAge, http.FileServer(http.Dir("./assets")))))
 
 	// old: mux.HandleFunc("/healthz", readiness(http.ResponseWriter, *http.Request)) WRONG!
 	// new:
-	mux.HandleFunc("POST /admin/reset", cfg.middlewareMetricsHandlerReset)
-	mux.HandleFunc("GET /api/healthz", readiness) // correct!
-	mux.HandleFunc("GET /admin/metrics", cfg.middlewareMetricsStats)
+	mux.HandleFunc("POST /admin/reset", cfg.middlewareRequireAdmin(cfg.middlewareMetricsHandlerReset))
+	mux.HandleFunc("GET /api/healthz", cfg.readiness) // correct!
+	mux.HandleFunc("GET /api/readyz", cfg.readyz)
+	mux.HandleFunc("GET /metrics", cfg.middlewareRequireAPIKey(scopeMetrics, cfg.metrics.handler().ServeHTTP)) // for Prometheus to scrape
+	mux.HandleFunc("GET /admin/metrics", cfg.middlewareRequireAdmin(cfg.middlewareMetricsStats))
+	mux.HandleFunc("POST /admin/refilter", cfg.middlewareRequireAdmin(cfg.middlewareMetricsRefilterChirps))
+	mux.HandleFunc("POST /admin/maintenance", cfg.middlewareRequireAdmin(cfg.middlewareMetricsSetMaintenance))
+	mux.HandleFunc("GET /admin/reports", cfg.middlewareRequireAdmin(cfg.middlewareMetricsGetReportedChirps))
+	mux.HandleFunc("POST /admin/users/{userID}/revoke", cfg.middlewareRequireAdmin(cfg.middlewareMetricsRevokeUserSessions))
+	mux.HandleFunc("DELETE /admin/users/{userID}/chirps", cfg.middlewareRequireAdmin(cfg.middlewareMetricsDeleteUserChirps))
+	mux.HandleFunc("POST /admin/service-accounts", cfg.middlewareRequireAdmin(cfg.middlewareMetricsCreateServiceAccount))
+	mux.HandleFunc("DELETE /admin/service-accounts/{clientID}", cfg.middlewareRequireAdmin(cfg.middlewareMetricsDeleteServiceAccount))
 	//mux.HandleFunc("POST /admin/reset", cfg.middlewareMetricsReset) //old reset that reset the page view counter
 	//mux.HandleFunc("POST /api/validate_chirp", cfg.middlewareMetricsValidate) // old seperate validate case
-	mux.HandleFunc("POST /api/chirps", cfg.middlewareMetricsCreateChirps)
-	mux.HandleFunc("GET /api/chirps", cfg.middlewareMetricsGetChirps)
+	mux.HandleFunc("POST /api/chirps", cfg.middlewareAuth(cfg.middlewareMetricsCreateChirps))
+	mux.HandleFunc("GET /api/chirps", cfg.middlewareOptionalAuth(cfg.middlewareMetricsGetChirps))
+	mux.HandleFunc("HEAD /api/chirps", cfg.middlewareOptionalAuth(cfg.middlewareMetricsHeadChirps)) // more specific than GET (which also matches HEAD), so it wins
 	mux.HandleFunc("POST /api/users", cfg.middlewareMetricsCreateUser)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.middlewareMetricsGetChirp)
+	mux.HandleFunc("GET /api/users/available", middlewareRateLimit(cfg.emailCheckLimiter, cfg.middlewareMetricsEmailAvailable))
+	mux.HandleFunc("PATCH /api/users", cfg.middlewareAuth(cfg.middlewareMetricsPatchUser))
+	mux.HandleFunc("DELETE /api/users", cfg.middlewareAuth(cfg.middlewareMetricsDeactivateUser))
+	mux.HandleFunc("POST /api/users/email/confirm", cfg.middlewareMetricsConfirmEmailChange)
+	mux.HandleFunc("POST /api/users/email/resend", cfg.middlewareAuth(cfg.middlewareMetricsResendEmailChange))
+	mux.HandleFunc("GET /api/users/{userID}/stats", cfg.middlewareMetricsGetUserStats)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.middlewareOptionalAuth(cfg.middlewareMetricsGetChirp))
+	mux.HandleFunc("GET /api/chirps/random", cfg.middlewareOptionalAuth(cfg.middlewareMetricsGetRandomChirps)) // more specific than {chirpID}, so it wins
+	mux.HandleFunc("GET /api/chirps/export", cfg.middlewareRequireAdmin(cfg.middlewareMetricsExportChirps))    // this too
+	mux.HandleFunc("GET /api/chirps/{chirpID}/links", cfg.middlewareOptionalAuth(cfg.middlewareMetricsGetChirpLinks))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", cfg.middlewareAuth(cfg.middlewareMetricsReportChirp))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/publish", cfg.middlewareAuth(cfg.middlewareMetricsPublishChirp))
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.middlewareAuth(cfg.middlewareMetricsUpdateChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/history", cfg.middlewareAuth(cfg.middlewareMetricsGetChirpHistory))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.middlewareAuth(cfg.middlewareMetricsDeleteChirp))
+	mux.HandleFunc("DELETE /api/me/chirps", cfg.middlewareAuth(cfg.middlewareMetricsDeleteMyChirps))
+	mux.HandleFunc("POST /api/me/pin", cfg.middlewareAuth(cfg.middlewareMetricsPinChirp))
+	mux.HandleFunc("DELETE /api/me/pin", cfg.middlewareAuth(cfg.middlewareMetricsUnpinChirp))
+	mux.HandleFunc("GET /api/me/settings", cfg.middlewareAuth(cfg.middlewareMetricsGetSettings))
+	mux.HandleFunc("PUT /api/me/settings", cfg.middlewareAuth(cfg.middlewareMetricsPutSettings))
 	mux.HandleFunc("POST /api/login", cfg.middlewareMetricsLoginUser)
-
-	// starts your server and keeps it running, handling incoming HTTP requests as per your routing rules.
-	err = newServer.ListenAndServe()
-	if err != nil {
-		log.Fatal(err)
-	}
-
+	mux.HandleFunc("GET /api/whoami", cfg.middlewareAuth(cfg.middlewareMetricsWhoAmI))
+	mux.HandleFunc("POST /api/token", cfg.middlewareMetricsIssueServiceToken)
+	mux.HandleFunc("POST /api/introspect", cfg.middlewareRequireAPIKey(scopeIntrospect, cfg.middlewareMetricsIntrospect))
+	mux.HandleFunc("GET /api/version", getVersion)
+	mux.HandleFunc("GET /api/openapi.json", serveOpenAPI)
+	mux.HandleFunc("GET /api/ws", cfg.middlewareMetricsChirpSocket)
+
+	// CORS goes outermost so preflights are answered before anything can turn them into an error
+	return middlewareAPIVersion(cfg.metrics.middleware(cfg.middlewareCORS(middlewareTrailingSlash(cfg.middlewareMaintenance(middlewareJSONNotFound(mux))))))
 }
 
 // "http.ResponseWriter" has methods like Header().Set() to set headers, WriteHeader() to set
@@ -142,24 +691,94 @@ func main() {
 // "*http.Request" includes things like the HTTP method (GET, POST, etc.),
 // the URL path, headers, and the request body (if there is one).
 // The server also creates this for you for each incoming request.
-func readiness(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8") // normal header
-	w.WriteHeader(200)                                          // status code
-	w.Write([]byte("OK"))                                       // << expects []byte, so type convert to have "OK" (for now)
+// GET /api/healthz - readiness check. In production it's just {"status": "ok"}; on the dev platform it also
+// says what's deployed (app and postgres versions, uptime), which we don't want to hand to strangers.
+func (cfg *apiConfig) readiness(w http.ResponseWriter, req *http.Request) {
+	if cfg.platform != "dev" {
+		jsonWriter(w, 200, Health{Status: "ok"})
+		return
+	}
+
+	jsonWriter(w, 200, Health{
+		Status:          "ok",
+		Version:         version,
+		DatabaseVersion: cfg.databaseVersion(req),
+		UptimeSeconds:   int64(time.Since(cfg.startedAt).Seconds()),
+	})
+}
+
+// databaseVersion is postgres's version() string. It only changes with a server upgrade (which means a
+// restart on our side too), so it's looked up once and cached rather than queried on every probe.
+func (cfg *apiConfig) databaseVersion(req *http.Request) string {
+	if cached := cfg.dbVersion.Load(); cached != nil {
+		return *cached
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbVersion, err := withRetry(ctx, cfg.dbRetry, cfg.db.GetServerVersion)
+	if err != nil {
+		logRequestError(req, "error getting database version", err)
+		return "unavailable" // not cached, so the next probe tries again
+	}
+	cfg.dbVersion.Store(&dbVersion)
+	return dbVersion
+}
 
+// reports which build is running, so we can tell what's actually deployed
+func getVersion(w http.ResponseWriter, req *http.Request) {
+	jsonWriter(w, 200, VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+	})
 }
 
 func (cfg *apiConfig) middlewareMetricsHandlerReset(w http.ResponseWriter, req *http.Request) { // **** UNDER CONSTRUCTION! ****
+	// admins only (see routes), AND only on dev - wiping the database is never OK in production
 	if cfg.platform != "dev" {
 		// 403 Forbidden
-		respondWithError(w, 403, "Forbidden")
+		respondWithError(w, 403, errCodeForbidden, "Forbidden")
 		return
 	}
-	err := cfg.db.Reset(context.Background())
+	if req.URL.Query().Get("dry_run") == "true" {
+		// report what WOULD be deleted, without touching anything
+		ctx, cancel := cfg.dbContext(req.Context())
+		userCount, err := withRetry(ctx, cfg.dbRetry, cfg.db.CountUsers)
+		cancel()
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error counting users", err)
+			return
+		}
+		ctx, cancel = cfg.dbContext(req.Context())
+		chirpCount, err := withRetry(ctx, cfg.dbRetry, cfg.db.CountChirps)
+		cancel()
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error counting chirps", err)
+			return
+		}
+		jsonWriter(w, 200, ResetDryRun{
+			DryRun: true,
+			Users:  userCount,
+			Chirps: chirpCount,
+		})
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	err := cfg.withTx(ctx, func(q database.Querier) error {
+		if err := q.Reset(ctx); err != nil {
+			return err
+		}
+		return q.TouchChirpList(ctx) // or Last-Modified would go back to before the chirps that were just deleted
+	})
 	if err != nil {
-		respondWithError(w, 400, "Bad Request")
+		cfg.respondWithDBError(w, req, "error resetting database", err)
+		return
 	}
-	fmt.Printf("Database successfully reset.")
+	cfg.chirpCache.Clear() // every chirp is gone, so nothing cached can be served any more
+	slog.Info("database successfully reset")
 	//return
 }
 
@@ -210,189 +829,1039 @@ func (cfg *apiConfig) middlewareMetricsStats(w http.ResponseWriter, req *http.Re
 func (cfg *apiConfig) middlewareMetricsCreateUser(w http.ResponseWriter, req *http.Request) {
 	// DECODE JSON REQUEST BODY:
 
-	decoder := json.NewDecoder(req.Body)
 	newUserParams := CreateUserRequest{}
-
-	err := decoder.Decode(&newUserParams)
-	if err != nil {
-		respondWithError(w, 500, "Error decoding params")
+	if !decodeJSONBody(w, req, maxRequestSize, &newUserParams) {
+		return
+	}
+	if fields := validateCreateUser(newUserParams); len(fields) > 0 {
+		respondWithFieldErrors(w, fields)
+		return
+	}
+	if cfg.isBreachedPassword(req, newUserParams.Password) {
+		respondWithFieldErrors(w, fieldErrors{"password": breachedPasswordMessage})
 		return
 	}
-	newUserParams.Password, err = auth.HashPassword(newUserParams.Password)
+
+	hashedPassword, err := cfg.passwordAlgorithm.Hash(newUserParams.Password)
 	if err != nil {
-		respondWithError(w, 500, "error creating password")
+		logRequestError(req, "error hashing password", err)
+		respondWithError(w, 500, errCodeInternal, "error creating password")
 		return
 	}
+	newUserParams.Password = hashedPassword
 
 	var createUserParams database.CreateUserParams
 	createUserParams.Email = newUserParams.Email
 	createUserParams.HashedPassword = newUserParams.Password
 
-	newUserRecord, err := cfg.db.CreateUser(context.Background(), createUserParams)
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	newUserRecord, err := cfg.db.CreateUser(ctx, createUserParams)
 
 	if err != nil {
 		//error creating new user
-		respondWithError(w, 500, "error creating user")
+		if isUniqueViolation(err) { // email column is UNIQUE
+			respondWithError(w, 409, errCodeEmailTaken, "email already in use")
+			return
+		}
+		cfg.respondWithDBError(w, req, "error creating user", err)
 		return
 	}
 
-	mainUser := User{ // converting to ensure security (not exposing sql field names, allows not returning specific values, like potential password, etc)
-		ID:        newUserRecord.ID,
-		CreatedAt: newUserRecord.CreatedAt,
-		UpdatedAt: newUserRecord.UpdatedAt,
-		Email:     newUserRecord.Email,
-	}
+	mainUser := userFromDB(newUserRecord)
 
 	jsonWriter(w, 201, mainUser)
 	//return
 }
 
-func (cfg *apiConfig) middlewareMetricsLoginUser(w http.ResponseWriter, req *http.Request) {
-
-	// DECODE JSON REQUEST BODY:
-
-	decoder := json.NewDecoder(req.Body)
-	userLoginParams := CreateUserRequest{}                    // struct with email and password
-	fmt.Println("Decoded login parameters:", userLoginParams) // debug
-	err := decoder.Decode(&userLoginParams)
-	if err != nil {
-		respondWithError(w, 500, "Error decoding params")
+// GET /api/users/available?email=... - whether POST /api/users would accept this email, so signup
+// forms can say so before the user has typed a password. Checked exactly as create-user stores it.
+func (cfg *apiConfig) middlewareMetricsEmailAvailable(w http.ResponseWriter, req *http.Request) {
+	email := req.URL.Query().Get("email")
+	if email == "" {
+		respondWithError(w, 400, errCodeBadRequest, "email is required")
 		return
 	}
-	fmt.Println("Decoded login parameters:", userLoginParams) // debug
-	if userLoginParams.ExpireTime == 0 || userLoginParams.ExpireTime > 3600 {
-		userLoginParams.ExpireTime = 3600 //one hour
-	}
-
-	expires := time.Duration(userLoginParams.ExpireTime) * time.Second
-
-	dbUserRecord, err := cfg.db.GetUserByEmail(context.Background(), userLoginParams.Email)
-	if err != nil {
-		respondWithError(w, 401, "Unauthorize (getuserbyemail failed)")
+	if !isValidEmail(email) {
+		respondWithError(w, 400, errCodeBadRequest, "email must be a valid email")
 		return
 	}
 
-	fmt.Println("Database user lookup error:", err) // after DB lookup debug
-	err = auth.CheckPasswordHash(userLoginParams.Password, dbUserRecord.HashedPassword)
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	exists, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (bool, error) {
+		return cfg.db.EmailExists(ctx, email)
+	})
 	if err != nil {
-		respondWithError(w, 401, "Unauthorized (checkpasswordhash failed)")
+		cfg.respondWithDBError(w, req, "error checking email", err)
 		return
 	}
 
-	fmt.Println("Password hash check error:", err) // after password check debug
-	token, err := auth.MakeJWT(dbUserRecord.ID, cfg.secret, expires)
-	fmt.Println("JWT created:", token, "JWT creation error:", err) // after JWT creation
+	jsonWriter(w, 200, EmailAvailability{Available: !exists})
+}
 
-	//token, err := auth.GetBearerToken(req.Header) // WRONG
-	if err != nil {
-		respondWithError(w, 401, "Unauthorized")
+// PATCH /api/users - change your own email and/or password, leaving out whichever you don't want to change.
+// A new password applies straight away; a new email gets 202 and waits for POST /api/users/email/confirm.
+func (cfg *apiConfig) middlewareMetricsPatchUser(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	params := PatchUserRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
 		return
 	}
-
-	mainUser := User{ // converting to ensure security (not exposing sql field names, allows not returning specific values, like potential password, etc)
-		ID:        dbUserRecord.ID,
-		CreatedAt: dbUserRecord.CreatedAt,
-		UpdatedAt: dbUserRecord.UpdatedAt,
-		Email:     dbUserRecord.Email,
-		Token:     token,
+	if params.Email == nil && params.Password == nil {
+		respondWithError(w, 400, errCodeBadRequest, "nothing to update: send email and/or password")
+		return
 	}
 
-	jsonWriter(w, 200, mainUser)
-	//return
-
-}
+	var updateParams database.UpdateUserParams
+	updateParams.ID = userID
+	newEmail := "" // a new email isn't applied here, only once it's confirmed (see requestEmailChange)
+	if params.Email != nil {
+		if *params.Email == "" {
+			respondWithError(w, 400, errCodeBadRequest, "email can't be empty")
+			return
+		}
+		if !isValidEmail(*params.Email) { // same check as signup, so an address we'd never accept can't be confirmed
+			respondWithFieldErrors(w, fieldErrors{"email": "must be a valid email"})
+			return
+		}
+		newEmail = *params.Email
+	}
+	if params.Password != nil { // only re-hash when there's a new password
+		if *params.Password == "" {
+			respondWithError(w, 400, errCodeBadRequest, "password can't be empty")
+			return
+		}
+		if cfg.isBreachedPassword(req, *params.Password) {
+			respondWithFieldErrors(w, fieldErrors{"password": breachedPasswordMessage})
+			return
+		}
+		hashedPassword, err := cfg.passwordAlgorithm.Hash(*params.Password)
+		if err != nil {
+			logRequestError(req, "error hashing password", err, "user_id", userID)
+			respondWithError(w, 500, errCodeInternal, "error updating password")
+			return
+		}
+		updateParams.HashedPassword = sql.NullString{String: hashedPassword, Valid: true}
+	}
 
-func (cfg *apiConfig) middlewareMetricsCreateChirps(w http.ResponseWriter, req *http.Request) {
+	// check the email is free before changing anything, so a 409 doesn't leave the password half-updated
+	if newEmail != "" {
+		ctx, cancel := cfg.dbContext(req.Context())
+		owner, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+			return cfg.db.GetUserByEmail(ctx, newEmail)
+		})
+		cancel()
+		switch {
+		case err == nil && owner.ID == userID:
+			newEmail = "" // it's already theirs, nothing to confirm
+		case err == nil:
+			respondWithError(w, 409, errCodeEmailTaken, "email already in use")
+			return
+		case !errors.Is(err, sql.ErrNoRows):
+			cfg.respondWithDBError(w, req, "error checking email", err, "user_id", userID)
+			return
+		}
+	}
+	// and that requestEmailChange won't turn it down for coming too soon after the last one
+	if newEmail != "" {
+		wait, err := cfg.emailChangeCooldown(req.Context(), userID)
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error checking email change", err, "user_id", userID)
+			return
+		}
+		if wait > 0 {
+			respondWithEmailCooldown(w, &emailCooldownError{wait: wait})
+			return
+		}
+	}
 
-	// DECODE JSON REQUEST BODY:
+	var dbUser database.User
+	var err error
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	if updateParams.HashedPassword.Valid {
+		dbUser, err = cfg.db.UpdateUser(ctx, updateParams)
+	} else {
+		dbUser, err = withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+			return cfg.db.GetUserByID(ctx, userID)
+		})
+	}
+	if errors.Is(err, sql.ErrNoRows) { // token for a user that's since been deleted
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error updating user", err, "user_id", userID)
+		return
+	}
 
-	decoder := json.NewDecoder(req.Body)
-	params := CreateChirp{}
+	user := userFromDB(dbUser)
+	if newEmail == "" {
+		jsonWriter(w, 200, user)
+		return
+	}
 
-	err := decoder.Decode(&params)
+	err = cfg.requestEmailChange(req, userID, newEmail)
+	var cooldown *emailCooldownError
+	if errors.As(err, &cooldown) { // another request got in since the check above
+		respondWithEmailCooldown(w, cooldown)
+		return
+	}
 	if err != nil {
-		respondWithError(w, 500, "Error decoding params")
+		cfg.respondWithDBError(w, req, "error requesting email change", err, "user_id", userID)
 		return
 	}
+	jsonWriter(w, 202, user) // still the old email: it only changes once confirmed
+}
 
-	// params is a struct with data populated successfully
-	token, err := auth.GetBearerToken(req.Header)
+// GET /api/whoami - the user the access token belongs to, so clients don't have to decode the JWT themselves
+func (cfg *apiConfig) middlewareMetricsWhoAmI(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbUser, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) { // token for a user that's since been deleted
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
 	if err != nil {
-		respondWithError(w, 401, "Unauthorized")
+		cfg.respondWithDBError(w, req, "error getting user", err, "user_id", userID)
 		return
 	}
 
-	userIDVerified, err := auth.ValidateJWT(token, cfg.secret)
+	jsonWriter(w, 200, userFromDB(dbUser))
+}
+
+// GET /api/users/{userID}/stats - chirp totals for a profile page, all computed in one aggregate query
+func (cfg *apiConfig) middlewareMetricsGetUserStats(w http.ResponseWriter, req *http.Request) {
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
 	if err != nil {
-		respondWithError(w, 401, "Unauthorized")
+		respondWithError(w, 400, errCodeInvalidID, "invalid user id")
 		return
 	}
 
-	characterCount := len(params.Body)
+	// the stats query happily returns zeros for a user that doesn't exist, so check first
+	ctx, cancel := cfg.dbContext(req.Context())
+	dbUser, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userUUID)
+	})
+	cancel()
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && dbUser.DeactivatedAt.Valid) { // deactivated counts as gone
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting user", err, "user_id", userUUID)
+		return
+	}
 
-	fmt.Printf("Character count using len: %v", characterCount)
+	ctx, cancel = cfg.dbContext(req.Context())
+	dbStats, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.UserChirpStatsRow, error) {
+		return cfg.db.UserChirpStats(ctx, userUUID)
+	})
+	cancel()
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting user stats", err, "user_id", userUUID)
+		return
+	}
 
-	// ENCODE JSON RESPONSE BODY:
+	stats := UserStats{
+		TotalChirps:   dbStats.TotalChirps,
+		AverageLength: dbStats.AverageLength,
+	}
+	if dbStats.LatestChirpAt.Valid {
+		latest := newTimestamp(dbStats.LatestChirpAt.Time)
+		stats.LatestChirpAt = &latest
+	}
+	if dbUser.LastSeenAt.Valid {
+		lastSeen := newTimestamp(dbUser.LastSeenAt.Time)
+		stats.LastSeenAt = &lastSeen
+	}
+
+	jsonWriter(w, 200, stats)
+}
+
+func (cfg *apiConfig) middlewareMetricsLoginUser(w http.ResponseWriter, req *http.Request) {
+
+	// DECODE JSON REQUEST BODY:
 
-	if characterCount > 140 { //invalid case
-		respondWithError(w, 400, "Chirp is too long")
+	userLoginParams := CreateUserRequest{} // struct with email and password
+	if !decodeJSONBody(w, req, maxRequestSize, &userLoginParams) {
+		return
+	}
+	slog.Debug("login attempt", "email", userLoginParams.Email) // never log the password!
+	// clients can ask for a shorter-lived token, never a longer one than ACCESS_TOKEN_TTL
+	expires := time.Duration(userLoginParams.ExpireTime) * time.Second
+	if userLoginParams.ExpireTime == 0 || expires > cfg.accessTokenTTL {
+		expires = cfg.accessTokenTTL
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbUserRecord, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByEmail(ctx, userLoginParams.Email)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, errCodeUnauthorized, "Unauthorize (getuserbyemail failed)")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting user", err)
+		return
+	}
+
+	err = auth.CheckPasswordHash(userLoginParams.Password, dbUserRecord.HashedPassword)
+	if err != nil {
+		respondWithError(w, 401, errCodeUnauthorized, "Unauthorized (checkpasswordhash failed)")
 		return
 	}
-	// At this point, CHIRP is good to go:
-	var chirpParams database.CreateChirpParams
-	chirpParams.Body = filterProfanity(params.Body) // not sure if we're still filtering, but this would be teh place to do so
-	chirpParams.UserID = userIDVerified
 
-	dbChirp, err := cfg.db.CreateChirp(context.Background(), chirpParams)
+	// logging in to a deactivated account brings it back, unless it's past the grace period and waiting to be purged
+	if dbUserRecord.DeactivatedAt.Valid {
+		if !cfg.canReactivate(dbUserRecord.DeactivatedAt.Time) {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized (account deactivated)")
+			return
+		}
+		err = cfg.withTx(ctx, func(q database.Querier) error {
+			if err := q.ReactivateUser(ctx, dbUserRecord.ID); err != nil {
+				return err
+			}
+			return q.TouchChirpList(ctx) // their chirps are back in the list
+		})
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error reactivating user", err, "user_id", dbUserRecord.ID)
+			return
+		}
+		slog.Info("user reactivated", "user_id", dbUserRecord.ID, "request_id", requestIDFromContext(req.Context()))
+	}
+
+	token, err := cfg.jwtKeys.MakeJWT(dbUserRecord.ID, expires, cfg.audience)
+
+	//token, err := auth.GetBearerToken(req.Header) // WRONG
 	if err != nil {
-		respondWithError(w, 500, "error creating chirp")
+		logRequestError(req, "error creating jwt", err, "user_id", dbUserRecord.ID)
+		respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
 		return
 	}
 
-	mainChirp := Chirp{ // converting to ensure security (not exposing sql field names, allows not returning specific values, like potential password, etc)
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	// ?set_cookie=true: browser clients also get the token as an HttpOnly cookie, so page scripts never
+	// have to store it (and can't leak it). middlewareAuth reads it back when there's no Authorization header.
+	if req.URL.Query().Get("set_cookie") == "true" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cfg.authCookieName,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(expires.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.authCookieSecure,
+			SameSite: http.SameSiteLaxMode, // not sent on cross-site POSTs, which keeps CSRF out
+		})
+	}
+
+	mainUser := userFromDB(dbUserRecord)
+	mainUser.Token = token
+
+	jsonWriter(w, 200, mainUser)
+	//return
+
+}
+
+func (cfg *apiConfig) middlewareMetricsCreateChirps(w http.ResponseWriter, req *http.Request) {
+
+	// DECODE JSON REQUEST BODY:
+
+	params := CreateChirp{}
+	if !decodeJSONBody(w, req, maxChirpRequestSize, &params) {
+		return
 	}
 
+	// params is a struct with data populated successfully
+	userIDVerified, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	mainChirp, created, err := cfg.saveChirp(req.Context(), userIDVerified, params)
+	var invalid *chirpInvalidError
+	if errors.As(err, &invalid) {
+		resp := fieldErrorResponse(invalid.fields)
+		if invalid.length > cfg.maxChirpLength {
+			resp.Max, resp.Length = cfg.maxChirpLength, invalid.length // same as a chirp_too_long error
+		}
+		jsonWriter(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	var rejected *chirpRejectedError
+	if errors.As(err, &rejected) {
+		respondWithError(w, 422, errCodeChirpRejected, rejected.reason)
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error creating chirp", err, "user_id", userIDVerified)
+		return
+	}
+
+	if !created { // the same chirp again within CHIRP_DEDUPE_SECONDS: hand back the first one instead
+		jsonWriter(w, 200, mainChirp)
+		return
+	}
 	jsonWriter(w, 201, mainChirp)
 	//return
 }
 
+// chirpInvalidError is what saveChirp returns when validateCreateChirp finds something wrong
+type chirpInvalidError struct {
+	fields fieldErrors
+	length int // of the sanitized body, in bytes
+}
+
+func (e *chirpInvalidError) Error() string {
+	return "invalid chirp"
+}
+
+// saveChirp sanitizes, checks, censors and stores a new chirp (plus any links in it), then publishes it to
+// chirpHub for live subscribers if it's public and not a draft. Shared by POST /api/chirps and the WebSocket (GET /api/ws).
+// Returns a *chirpInvalidError if params don't pass validateCreateChirp, or a *chirpRejectedError if
+// cfg.moderator turns it down. If the same chirp was already posted within cfg.chirpDedupeWindow, that one
+// is returned instead, with created false.
+func (cfg *apiConfig) saveChirp(ctx context.Context, userID uuid.UUID, params CreateChirp) (Chirp, bool, error) {
+	body := sanitizeChirpBody(params.Body)
+	params.Body = body
+	slog.Debug("creating chirp", "character_count", len(body)) // debug only: this runs on every chirp
+
+	if fields := cfg.validateCreateChirp(params); len(fields) > 0 {
+		return Chirp{}, false, &chirpInvalidError{fields: fields, length: len(body)}
+	}
+	visibility, _ := parseVisibility(params.Visibility) // already checked by validateCreateChirp
+	lang, _ := parseLang(params.Lang)                   // this too
+	status, _ := parseChirpStatus(params.Status)        // and this
+	mediaURL, _ := parseMediaURL(params.MediaURL)       // and this
+
+	if cfg.chirpDedupeWindow > 0 {
+		duplicate, err := cfg.findDuplicateChirp(ctx, userID, body, visibility, lang, status, mediaURL)
+		if err == nil {
+			return duplicate, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Chirp{}, false, fmt.Errorf("checking for duplicate chirp: %w", err)
+		}
+	}
+
+	censored := cfg.censor(body)
+
+	// the moderator gets what the author actually wrote, not the censored version
+	allowed, reason, err := cfg.moderator.Moderate(ctx, body)
+	if err != nil {
+		return Chirp{}, false, fmt.Errorf("moderating chirp: %w", err)
+	}
+	if !allowed {
+		return Chirp{}, false, &chirpRejectedError{reason: reason}
+	}
+
+	// At this point, CHIRP is good to go:
+	var chirpParams database.CreateChirpParams
+	chirpParams.Body = censored
+	chirpParams.UserID = userID
+	chirpParams.Visibility = visibility
+	chirpParams.Lang = lang
+	chirpParams.Status = status
+	chirpParams.MediaUrl = mediaURL
+
+	dbCtx, cancel := cfg.dbContext(ctx)
+	dbChirp, err := cfg.db.CreateChirp(dbCtx, chirpParams)
+	cancel()
+	if err != nil {
+		return Chirp{}, false, err
+	}
+
+	// store any links for previews later. The chirp itself is already saved, so a failure here
+	// gets logged but doesn't fail the request.
+	for _, link := range extractLinks(dbChirp.Body) {
+		dbCtx, cancel := cfg.dbContext(ctx)
+		err = cfg.db.CreateChirpLink(dbCtx, database.CreateChirpLinkParams{
+			ChirpID: dbChirp.ID,
+			Url:     link,
+		})
+		cancel()
+		if err != nil {
+			slog.ErrorContext(ctx, "error storing chirp link", "error", err, "chirp_id", dbChirp.ID, "request_id", requestIDFromContext(ctx))
+		}
+	}
+
+	mainChirp := chirpFromDB(dbChirp)
+
+	if isBroadcast(dbChirp) { // every subscriber gets every chirp, so only public, published ones go out
+		cfg.chirpHub.Publish(mainChirp)
+	}
+	mainChirp.Filtered = censored != body // just for the author, so it's set after publishing
+	return mainChirp, true, nil
+}
+
 func (cfg *apiConfig) middlewareMetricsGetChirp(w http.ResponseWriter, req *http.Request) {
 	chirpIDString := req.PathValue("chirpID") // pulls the chirp id from the path string as a STRING
-	fmt.Println(chirpIDString)
+	slog.Debug("getting chirp", "chirp_id", chirpIDString)
 
 	chirpUUID, err := uuid.Parse(chirpIDString) // converts the string into a UUID
 	if err != nil {
-		respondWithError(w, 500, "UUID error")
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+	loc, err := parseTimezone(req.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	// check the cache first, and only go to the database on a miss
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	if err != nil || !canView(dbChirp, viewerFromContext(req.Context())) { // 404 rather than 403, so private chirps don't give away that they exist
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+
+	mainChirp := chirpFromDB(dbChirp)
+
+	jsonWriter(w, 200, mainChirp.inTimezone(loc))
+
+}
+
+// GET /api/chirps/{chirpID}/links - the links found in a chirp when it was created
+func (cfg *apiConfig) middlewareMetricsGetChirpLinks(w http.ResponseWriter, req *http.Request) {
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	// no links could just mean no chirp, so check it exists (and this user can see it) first
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	if err != nil || !canView(dbChirp, viewerFromContext(req.Context())) {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbLinks, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.ChirpLink, error) {
+		return cfg.db.GetChirpLinks(ctx, chirpUUID)
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting chirp links", err, "chirp_id", chirpUUID)
 		return
 	}
 
-	dbChirp, err := cfg.db.GetChirpByChirpUUID(context.Background(), chirpUUID)
+	links := []ChirpLink{} // send [] rather than null when there aren't any
+	for _, link := range dbLinks {
+		links = append(links, ChirpLink{
+			URL:       link.Url,
+			CreatedAt: newTimestamp(link.CreatedAt),
+		})
+	}
+
+	jsonWriter(w, 200, links)
+}
+
+// GET /api/chirps/{chirpID}/history - the chirp's earlier versions, oldest first. Only its author can see them.
+func (cfg *apiConfig) middlewareMetricsGetChirpHistory(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, 404, "chirp not found")
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
 		return
 	}
 
-	mainChirp := Chirp{ // converting to ensure security (not exposing sql field names, allows not returning specific values, like potential password, etc)
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	// 404 for chirps they can't see at all, like GET /api/chirps/{chirpID}, so this can't be used to find
+	// out a private chirp or draft exists; 403 only for ones they can see but didn't write
+	if err != nil || !canView(dbChirp, uuid.NullUUID{UUID: userID, Valid: true}) {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+	if dbChirp.UserID != userID {
+		respondWithError(w, 403, errCodeForbidden, "you can only see the history of your own chirps")
+		return
 	}
 
-	jsonWriter(w, 200, mainChirp)
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbRevisions, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.ChirpRevision, error) {
+		return cfg.db.GetChirpRevisions(ctx, chirpUUID)
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting chirp history", err, "chirp_id", chirpUUID)
+		return
+	}
 
+	revisions := []ChirpRevision{} // send [] rather than null for a chirp that's never been edited
+	for _, revision := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			Body:      revision.Body,
+			CreatedAt: newTimestamp(revision.CreatedAt),
+		})
+	}
+
+	jsonWriter(w, 200, revisions)
 }
 
+// what the checks in middlewareMetricsUpdateChirp's transaction return, to roll it back
+var (
+	errNotChirpAuthor = errors.New("not the chirp's author")
+	errChirpModified  = errors.New("chirp modified since If-Unmodified-Since")
+)
+
+func (cfg *apiConfig) middlewareMetricsUpdateChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	params := UpdateChirpRequest{}
+	if !decodeJSONBody(w, req, maxChirpRequestSize, &params) {
+		return
+	}
+	if params.Body == nil && params.Visibility == "" && params.MediaURL == nil {
+		respondWithError(w, 400, errCodeBadRequest, "nothing to update: send body, visibility and/or media_url")
+		return
+	}
+
+	var body sql.NullString // not Valid: UpdateChirp keeps the current one
+	if params.Body != nil {
+		sanitized := sanitizeChirpBody(*params.Body)
+		if strings.TrimSpace(sanitized) == "" {
+			respondWithError(w, 400, errCodeBadRequest, "body can't be empty")
+			return
+		}
+		if len(sanitized) > cfg.maxChirpLength {
+			cfg.respondWithChirpTooLong(w, len(sanitized))
+			return
+		}
+		body = sql.NullString{String: cfg.censor(sanitized), Valid: true}
+	}
+
+	var visibility database.NullChirpVisibility // not Valid: UpdateChirp keeps the current one
+	if params.Visibility != "" {
+		parsed, err := parseVisibility(params.Visibility)
+		if err != nil {
+			respondWithError(w, 400, errCodeBadRequest, err.Error())
+			return
+		}
+		visibility = database.NullChirpVisibility{ChirpVisibility: parsed, Valid: true}
+	}
+
+	var mediaURL sql.NullString // only used if params.MediaURL is set; "" clears it
+	if params.MediaURL != nil {
+		mediaURL, err = parseMediaURL(*params.MediaURL)
+		if err != nil {
+			respondWithError(w, 400, errCodeBadRequest, err.Error())
+			return
+		}
+	}
+
+	// If-Unmodified-Since: "only apply my edit if nobody has changed the chirp since I last saw it".
+	// Stops two clients from silently overwriting each other's edits (the "lost update" problem).
+	var unmodifiedSince time.Time
+	if header := req.Header.Get("If-Unmodified-Since"); header != "" {
+		unmodifiedSince, err = http.ParseTime(header)
+		if err != nil {
+			respondWithError(w, 400, errCodeBadRequest, "invalid If-Unmodified-Since header")
+			return
+		}
+	}
+
+	// the checks read the chirp with GetChirpForUpdate (never the cache), which locks it until the update
+	// commits: another edit can't slip in between, so two editors can't both pass If-Unmodified-Since.
+	// The old body goes into chirp_revisions in the same transaction, so the history never misses an edit.
+	// Edits that leave the body alone don't add a revision: the history is of what the chirp said.
+	var updatedChirp database.Chirp
+	err = cfg.withTx(req.Context(), func(q database.Querier) error {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+
+		current, err := q.GetChirpForUpdate(ctx, chirpUUID)
+		if err != nil {
+			return err
+		}
+		if current.UserID != userID {
+			if !canView(current, uuid.NullUUID{UUID: userID, Valid: true}) {
+				return sql.ErrNoRows // someone else's private chirp or draft: 404, as if it weren't there
+			}
+			return errNotChirpAuthor
+		}
+		// HTTP dates only have whole-second precision, so drop the sub-second part before comparing
+		if !unmodifiedSince.IsZero() && current.UpdatedAt.Truncate(time.Second).After(unmodifiedSince) {
+			return errChirpModified
+		}
+
+		if body.Valid {
+			if err := q.CreateChirpRevision(ctx, chirpUUID); err != nil {
+				return err
+			}
+		}
+		updatedChirp, err = q.UpdateChirp(ctx, database.UpdateChirpParams{
+			ID:          chirpUUID,
+			Body:        body,
+			Visibility:  visibility,
+			SetMediaUrl: params.MediaURL != nil,
+			MediaUrl:    mediaURL,
+		})
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	case errors.Is(err, errNotChirpAuthor):
+		respondWithError(w, 403, errCodeForbidden, "you can only edit your own chirps")
+		return
+	case errors.Is(err, errChirpModified):
+		respondWithError(w, 412, errCodeConflict, "chirp has been modified since "+req.Header.Get("If-Unmodified-Since"))
+		return
+	case err != nil:
+		cfg.respondWithDBError(w, req, "error updating chirp", err, "user_id", userID)
+		return
+	}
+	cfg.chirpCache.Remove(chirpUUID) // cached copy is stale now
+
+	w.Header().Set("Last-Modified", updatedChirp.UpdatedAt.UTC().Format(http.TimeFormat))
+	jsonWriter(w, 200, chirpFromDB(updatedChirp))
+}
+
+// DELETE /api/chirps/{chirpID} - authors can delete their own chirps, and admins (moderators) can delete anyone's.
+func (cfg *apiConfig) middlewareMetricsDeleteChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	dbChirp, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+		return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+	})
+	cancel()
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+
+	isAuthor := dbChirp.UserID == userID
+	if !isAuthor {
+		// not their chirp - only allowed if they're an admin. Anyone else gets 404 for one they can't
+		// see, like GET /api/chirps/{chirpID}, and 403 for one they can.
+		admin, err := cfg.isAdmin(req.Context(), userID)
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error checking admin", err, "user_id", userID)
+			return
+		}
+		if !admin {
+			if !canView(dbChirp, uuid.NullUUID{UUID: userID, Valid: true}) {
+				respondWithError(w, 404, errCodeNotFound, "chirp not found")
+				return
+			}
+			respondWithError(w, 403, errCodeForbidden, "you can only delete your own chirps")
+			return
+		}
+	}
+
+	// with ?return=true the chirp is read again in the delete's transaction, so what comes back (say,
+	// for an undo button) is what was actually deleted, even if it was edited since the check above
+	returnDeleted := req.URL.Query().Get("return") == "true"
+	var deleted database.Chirp
+	err = cfg.withTx(req.Context(), func(q database.Querier) error {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+
+		if returnDeleted {
+			var err error
+			deleted, err = q.GetChirpByChirpUUID(ctx, chirpUUID)
+			if err != nil {
+				return err
+			}
+		}
+		if err := q.DeleteChirp(ctx, chirpUUID); err != nil {
+			return err
+		}
+		return q.TouchChirpList(ctx)
+	})
+	if errors.Is(err, sql.ErrNoRows) { // someone else deleted it first
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error deleting chirp", err, "user_id", userID, "chirp_id", chirpUUID)
+		return
+	}
+	cfg.chirpCache.Remove(chirpUUID)
+
+	if !isAuthor {
+		// moderation actions get their own log line, so they're easy to audit
+		slog.Warn("admin deleted another user's chirp",
+			"admin_id", userID,
+			"chirp_id", chirpUUID,
+			"author_id", dbChirp.UserID,
+			"request_id", requestIDFromContext(req.Context()),
+		)
+	}
+
+	if returnDeleted {
+		jsonWriter(w, 200, chirpFromDB(deleted))
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// DELETE /api/me/chirps - deletes every one of the caller's chirps (but not their account), for a clean slate.
+// Chirps are hard-deleted, same as DELETE /api/chirps/{chirpID}; their links, reports and revisions go with them (ON DELETE CASCADE).
+func (cfg *apiConfig) middlewareMetricsDeleteMyChirps(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	deleted, err := cfg.deleteChirpsByUser(req.Context(), userID)
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error deleting chirps", err, "user_id", userID)
+		return
+	}
+
+	slog.Info("user deleted all their chirps",
+		"user_id", userID,
+		"deleted", deleted,
+		"request_id", requestIDFromContext(req.Context()),
+	)
+	jsonWriter(w, 200, DeletedChirps{Deleted: deleted})
+}
+
+// DELETE /admin/users/{userID}/chirps - wipes every chirp a user has posted (a spammer's, say), leaving the account.
+// Hard deletes, like DELETE /api/me/chirps.
+func (cfg *apiConfig) middlewareMetricsDeleteUserChirps(w http.ResponseWriter, req *http.Request) {
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid user id")
+		return
+	}
+
+	// deleting nothing would look the same as a user with no chirps, so check they exist first
+	ctx, cancel := cfg.dbContext(req.Context())
+	_, err = withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userUUID)
+	})
+	cancel()
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting user", err, "user_id", userUUID)
+		return
+	}
+
+	deleted, err := cfg.deleteChirpsByUser(req.Context(), userUUID)
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error deleting chirps", err, "user_id", userUUID)
+		return
+	}
+
+	adminID, _ := userIDFromContext(req.Context())
+	// a warning, like other moderator actions: it destroys someone else's content
+	slog.Warn("admin deleted a user's chirps",
+		"user_id", userUUID,
+		"admin_id", adminID,
+		"deleted", deleted,
+		"request_id", requestIDFromContext(req.Context()),
+	)
+	jsonWriter(w, 200, DeletedChirps{Deleted: deleted})
+}
+
+// deleteChirpsByUser deletes all of userID's chirps in one transaction and drops them from the cache.
+// Their links, reports and revisions go with them (ON DELETE CASCADE). Returns how many there were.
+func (cfg *apiConfig) deleteChirpsByUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	var deletedIDs []uuid.UUID
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	err := cfg.withTx(dbCtx, func(q database.Querier) error {
+		var err error
+		deletedIDs, err = q.DeleteChirpsByUser(dbCtx, userID)
+		if err != nil {
+			return err
+		}
+		return q.TouchChirpList(dbCtx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, chirpID := range deletedIDs {
+		cfg.chirpCache.Remove(chirpID)
+	}
+	return len(deletedIDs), nil
+}
+
+// HEAD /api/chirps - just the headers (with the total in X-Total-Count), no body.
+// Lets clients cheaply check whether there's anything new without downloading every chirp.
+func (cfg *apiConfig) middlewareMetricsHeadChirps(w http.ResponseWriter, req *http.Request) {
+	viewer := viewerFromContext(req.Context()) // the count matches what GET would return to the same user
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	chirpCount, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (int64, error) {
+		return cfg.db.CountVisibleChirps(ctx, viewer)
+	})
+	if err != nil {
+		logRequestError(req, "error counting chirps", err)
+		status := 500
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = 503
+		}
+		if isPoolExhausted(err) {
+			w.Header().Set("Retry-After", dbBusyRetryAfter)
+			status = 503
+		}
+		w.WriteHeader(status) // HEAD responses can't have a body, so no error JSON
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.FormatInt(chirpCount, 10))
+	w.WriteHeader(200)
+}
+
+// GET /api/chirps - every chirp the caller can see, oldest first (or just ?ids=..., or one page
+// at a time with ?limit= and ?before= - see respondWithChirpPage). ?lang=en, ?author_id= and ?q= (text in the
+// body, case-insensitive) narrow it down and combine with each other and with paging; ?sort=asc|desc flips the order.
+// ?tz=Europe/Paris shows timestamps in that zone instead of UTC (the single-chirp and random endpoints take it too).
+// Last-Modified is the last time any chirp was edited, deleted, or hidden or shown with its author's account
+// (see GetNewestChirpTimestamp), and the ETag is the same time to the microsecond, so polling clients can
+// send If-None-Match (or If-Modified-Since) and get a 304 instead of the whole list.
 func (cfg *apiConfig) middlewareMetricsGetChirps(w http.ResponseWriter, req *http.Request) {
-	chirpsSlice, err := cfg.db.GetChirps(context.Background())
+	var chirpsSlice []database.Chirp
+	var err error
+	viewer := viewerFromContext(req.Context()) // logged out: public chirps only; logged in: plus your own private ones
+
+	filter, err := parseChirpFilter(req.URL.Query(), isPageRequest(req)) // pages default to newest first, the full list to oldest
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	loc, err := parseTimezone(req.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+	if (filter.isSet() || req.URL.Query().Has("sort")) && req.URL.Query().Has("ids") {
+		respondWithError(w, 400, errCodeBadRequest, "ids can't be combined with lang, author_id, q or sort")
+		return
+	}
+	// the rest of the query is checked before the 304 below too, so a bad one never gets a 304
+	var page chirpPage
+	var chirpIDs []uuid.UUID
+	idsParam := req.URL.Query().Get("ids")
+	if isPageRequest(req) {
+		if req.URL.Query().Has("ids") {
+			respondWithError(w, 400, errCodeBadRequest, "ids can't be combined with limit or before")
+			return
+		}
+		page, err = parseChirpPage(req.URL.Query())
+		if err != nil {
+			respondWithError(w, 400, errCodeBadRequest, err.Error())
+			return
+		}
+	} else if idsParam != "" {
+		// ?ids=uuid1,uuid2,... - fetch just those chirps, in one query (unknown IDs are simply left out)
+		chirpIDs, err = parseChirpIDs(idsParam)
+		if err != nil {
+			respondWithError(w, 400, errCodeInvalidID, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+
+	// looked up before the chirps themselves, so a chirp changing in between makes
+	// Last-Modified too old (one extra full response) rather than too new (a missed update)
+	newest, err := withRetry(ctx, cfg.dbRetry, cfg.db.GetNewestChirpTimestamp)
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error retrieving chirps", err)
+		return
+	}
+	if newest.Valid {
+		lastModified := newest.Time.UTC()
+		etag := chirpListETag(lastModified)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat)) // HTTP dates only go down to the second
+		w.Header().Set("ETag", etag)
+		if notModified(req, lastModified, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	if isPageRequest(req) {
+		cfg.respondWithChirpPage(w, req, viewer, filter, page, loc)
+		return
+	}
+
+	if idsParam != "" {
+		chirpsSlice, err = withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.Chirp, error) {
+			return cfg.db.GetChirpsByIDs(ctx, database.GetChirpsByIDsParams{
+				Ids:      chirpIDs,
+				ViewerID: viewer,
+			})
+		})
+	} else {
+		params := database.GetChirpsParams{
+			ViewerID:    viewer,
+			Lang:        filter.lang,
+			AuthorID:    filter.authorID,
+			BodyPattern: filter.bodyPattern,
+		}
+		chirpsSlice, err = withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.Chirp, error) {
+			if filter.newestFirst {
+				return cfg.db.GetChirpsNewestFirst(ctx, database.GetChirpsNewestFirstParams(params))
+			}
+			return cfg.db.GetChirps(ctx, params)
+		})
+	}
 	if err != nil {
-		respondWithError(w, 500, "error retrieving chirps")
+		cfg.respondWithDBError(w, req, "error retrieving chirps", err)
 		return
 	}
 
@@ -400,39 +1869,152 @@ func (cfg *apiConfig) middlewareMetricsGetChirps(w http.ResponseWriter, req *htt
 
 	for _, chirp := range chirpsSlice {
 
-		chirpsMainSlice = append(chirpsMainSlice, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+		chirpsMainSlice = append(chirpsMainSlice, chirpFromDB(chirp).inTimezone(loc))
 
 	}
 	jsonWriter(w, 200, chirpsMainSlice)
 }
 
-func filterProfanity(body string) string {
-	profanity := []string{"kerfuffle", "sharbert", "fornax"}
-	replaceString := "****"
-
-	wordSlice := strings.Split(body, " ")
+// chirpListETag is GET /api/chirps's ETag for a list last changed at lastModified. Weak, since the same
+// list can be sent in different time zones (?tz=).
+func chirpListETag(lastModified time.Time) string {
+	return `W/"` + strconv.FormatInt(lastModified.UnixMicro(), 10) + `"` // postgres keeps microseconds
+}
 
-	for i, word := range wordSlice {
-		for _, profane := range profanity {
-			if strings.ToLower(word) == profane {
-				wordSlice[i] = replaceString // NEED TO USE INDEX! Otherwise, word is a *copy* of the value
+// notModified reports whether what the client already has is still current: its If-None-Match has etag
+// in it, or, if it didn't send one, its If-Modified-Since is at or after lastModified. HTTP dates only go
+// down to the second, so a lastModified part way through since's second might be a change made after the
+// client's copy, in the same second - that counts as modified. A missing or unparseable header means no.
+func notModified(req *http.Request, lastModified time.Time, etag string) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			// GET compares weakly, so W/ on either side doesn't matter
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
 			}
 		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+const maxChirpIDsPerRequest = 100
+
+// parseChirpIDs turns "uuid1,uuid2,..." into UUIDs, dropping duplicates.
+// Any malformed ID fails the whole thing, as does asking for more than maxChirpIDsPerRequest.
+func parseChirpIDs(idsParam string) ([]uuid.UUID, error) {
+	var chirpIDs []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+
+	for _, idString := range strings.Split(idsParam, ",") {
+		idString = strings.TrimSpace(idString)
+		if idString == "" {
+			continue // tolerate "a,,b" and a trailing comma
+		}
+		chirpID, err := uuid.Parse(idString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chirp id: %q", idString)
+		}
+		if seen[chirpID] {
+			continue
+		}
+		seen[chirpID] = true
+		chirpIDs = append(chirpIDs, chirpID)
+	}
+
+	if len(chirpIDs) > maxChirpIDsPerRequest {
+		return nil, fmt.Errorf("too many ids (max %d)", maxChirpIDsPerRequest)
+	}
+	return chirpIDs, nil
+}
+
+func (cfg *apiConfig) chirpTooLongMessage() string {
+	return fmt.Sprintf("Chirp is too long (max %d characters)", cfg.maxChirpLength)
+}
+
+// respondWithChirpTooLong sends 400 chirp_too_long with the limit and the chirp's actual length (both in bytes),
+// so clients can say exactly how much to cut
+func (cfg *apiConfig) respondWithChirpTooLong(w http.ResponseWriter, length int) {
+	jsonWriter(w, 400, errResponse{
+		Error:  cfg.chirpTooLongMessage(),
+		Code:   errCodeChirpTooLong,
+		Max:    cfg.maxChirpLength,
+		Length: length,
+	})
+}
+
+// dbContext derives the context for one database call from ctx (normally the request's, so the query is
+// cancelled if the client goes away), with a cfg.dbTimeout deadline so a slow query fails fast instead
+// of hanging the request. Always call the returned cancel once the call is done.
+func (cfg *apiConfig) dbContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if cfg.dbTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, cfg.dbTimeout)
+}
+
+// withTx runs fn in a transaction, committing if it returns nil and rolling back if it doesn't.
+// Without a real connection (the mock database in tests) fn just runs against cfg.db.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q database.Querier) error) error {
+	_, ok := cfg.db.(*database.Queries)
+	if cfg.sqlDB == nil || !ok {
+		return fn(cfg.db)
+	}
+
+	tx, err := poolWaitDB{cfg.sqlDB}.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback() // does nothing once Commit has succeeded
 
-	return strings.Join(wordSlice, " ")
+	err = fn(database.New(cfg.metrics.instrumentDB(tx))) // rather than WithTx, so queries in transactions get timed too
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// respondWithDBError logs a failed database call and responds 503 if it ran out of time (see dbContext),
+// or 500 with msg for anything else. If it was left waiting for a connection because the pool was all in
+// use (see isPoolExhausted), the 503 says so and comes with Retry-After, so clients back off.
+func (cfg *apiConfig) respondWithDBError(w http.ResponseWriter, req *http.Request, msg string, err error, args ...any) {
+	logRequestError(req, msg, err, args...)
+	if isPoolExhausted(err) {
+		w.Header().Set("Retry-After", dbBusyRetryAfter)
+		respondWithError(w, 503, errCodeDBBusy, "server is busy, please try again shortly")
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		respondWithError(w, 503, errCodeDBTimeout, "database took too long to respond, please try again")
+		return
+	}
+	respondWithError(w, 500, errCodeInternal, msg)
+}
+
+// isEmptyBody reports whether a json.Decoder error means the client sent no body (or one that stops short).
+// That's the client's mistake, so it gets a 400 rather than the generic decode error.
+func isEmptyBody(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isUniqueViolation reports whether err is postgres complaining about a UNIQUE constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505" // unique_violation
+	}
+	return false
 }
 
-func respondWithError(w http.ResponseWriter, code int, msg string) {
+func respondWithError(w http.ResponseWriter, status int, code string, msg string) {
 
-	resp := errResponse{Error: msg}
-	jsonWriter(w, code, resp)
+	resp := errResponse{Error: msg, Code: code}
+	jsonWriter(w, status, resp)
 }
 
 func jsonWriter(w http.ResponseWriter, code int, payload interface{}) {
@@ -440,7 +2022,7 @@ func jsonWriter(w http.ResponseWriter, code int, payload interface{}) {
 	jsonBytes, err := json.Marshal(payload)
 
 	if err != nil {
-		fmt.Printf("error marshalling response: %v\n", err)
+		slog.Error("error marshalling response", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError) // auto handles setting header to 500 and body to error
 		return
 	}
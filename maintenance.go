@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// maintenanceMode says how much of the API is switched off (see middlewareMaintenance).
+// It's stored in apiConfig.maintenance as an atomic.Int32, so it can be flipped while requests are in flight.
+type maintenanceMode int32
+
+const (
+	maintenanceOff      maintenanceMode = iota // normal operation
+	maintenanceReadOnly                        // reads work, writes get 503
+	maintenanceFull                            // everything gets 503
+)
+
+// how long (in seconds) clients are told to wait before trying again
+const maintenanceRetryAfter = "120"
+
+var maintenanceModeNames = map[maintenanceMode]string{
+	maintenanceOff:      "off",
+	maintenanceReadOnly: "read_only",
+	maintenanceFull:     "full",
+}
+
+func (mode maintenanceMode) String() string {
+	return maintenanceModeNames[mode]
+}
+
+// parseMaintenanceMode turns "off", "read_only" or "full" into a maintenanceMode
+func parseMaintenanceMode(name string) (maintenanceMode, error) {
+	for mode, modeName := range maintenanceModeNames {
+		if strings.ToLower(name) == modeName {
+			return mode, nil
+		}
+	}
+	return maintenanceOff, fmt.Errorf("unknown maintenance mode %q (want off, read_only or full)", name)
+}
+
+type MaintenanceRequest struct {
+	Mode string `json:"mode"`
+}
+
+type MaintenanceStatus struct {
+	Mode string `json:"mode"`
+}
+
+// middlewareMaintenance answers 503 (with Retry-After) while maintenance mode is on: just for writes
+// in read_only mode, for everything in full mode. The health checks stay up so load balancers don't
+// pull the server, /metrics (which still needs the API key) so monitoring doesn't go blind, and /admin/ so an admin can switch maintenance back off.
+// POST /api/introspect and POST /api/token don't write anything, so read_only mode counts them as reads.
+func (cfg *apiConfig) middlewareMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := maintenanceMode(cfg.maintenance.Load())
+		if mode == maintenanceOff || r.URL.Path == "/api/healthz" || r.URL.Path == "/api/readyz" || r.URL.Path == "/metrics" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		isRead := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+			r.URL.Path == "/api/introspect" || r.URL.Path == "/api/token"
+		if mode == maintenanceReadOnly && isRead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		respondWithError(w, 503, errCodeMaintenance, "down for maintenance, please try again later")
+	})
+}
+
+// POST /admin/maintenance - switch maintenance mode with {"mode": "off" | "read_only" | "full"}
+func (cfg *apiConfig) middlewareMetricsSetMaintenance(w http.ResponseWriter, req *http.Request) {
+	params := MaintenanceRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+
+	mode, err := parseMaintenanceMode(params.Mode)
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, err.Error())
+		return
+	}
+
+	previous := maintenanceMode(cfg.maintenance.Swap(int32(mode)))
+	if previous != mode {
+		adminID, _ := userIDFromContext(req.Context())
+		// worth a warning: it changes what every client sees
+		slog.Warn("maintenance mode changed",
+			"from", previous.String(),
+			"to", mode.String(),
+			"admin_id", adminID,
+			"request_id", requestIDFromContext(req.Context()),
+		)
+	}
+
+	jsonWriter(w, 200, MaintenanceStatus{Mode: mode.String()})
+}
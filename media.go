@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxMediaURLLength is plenty for any real image or video link, and stops chirps dragging around
+// kilobytes of query string
+const maxMediaURLLength = 2048
+
+var errInvalidMediaURL = fmt.Errorf("media_url must be an http(s) URL of at most %d characters", maxMediaURLLength)
+
+// parseMediaURL checks a media_url from a request. Chirps only ever point at media hosted elsewhere -
+// we don't take uploads - so all that's checked is that it's an absolute http(s) URL. Empty means no media.
+func parseMediaURL(raw string) (sql.NullString, error) {
+	if raw == "" {
+		return sql.NullString{}, nil
+	}
+	if len(raw) > maxMediaURLLength {
+		return sql.NullString{}, errInvalidMediaURL
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return sql.NullString{}, errInvalidMediaURL
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if (scheme != "http" && scheme != "https") || parsed.Host == "" {
+		return sql.NullString{}, errInvalidMediaURL
+	}
+	return sql.NullString{String: raw, Valid: true}, nil
+}
+
+// chirpMediaURL is the Chirp.MediaURL for a stored media_url: nil when there isn't one
+func chirpMediaURL(mediaURL sql.NullString) *string {
+	if !mediaURL.Valid {
+		return nil
+	}
+	return &mediaURL.String
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics is what GET /metrics exposes, in Prometheus' text format. Each apiConfig gets its own
+// registry rather than the global default one, so tests can build as many configs as they like.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec   // by method, route and status
+	requestDuration *prometheus.HistogramVec // by method and route
+	dbQueryDuration *prometheus.HistogramVec // by sqlc query name
+}
+
+// newMetrics registers everything we export. fileserverHits is the same counter GET /admin/metrics shows.
+func newMetrics(fileserverHits *atomic.Int32) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_http_requests_total",
+			Help: "HTTP requests handled, by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_http_request_duration_seconds",
+			Help:    "How long HTTP requests took, by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		dbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_db_query_duration_seconds",
+			Help:    "How long database queries took, by query name.",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}, // queries should be much quicker than whole requests
+		}, []string{"query"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.dbQueryDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "chirpy_fileserver_hits",
+			Help: "Requests to /app/ since startup or the last POST /admin/reset.",
+		}, func() float64 {
+			return float64(fileserverHits.Load())
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// handler serves GET /metrics for Prometheus to scrape
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// middleware counts and times every request. It has to sit outside the mux and anything that might
+// answer first (CORS, maintenance...), and the mux has to be handed this same *http.Request, because
+// req.Pattern - which route matched - only gets filled in once the mux has run.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK} // 200 if the handler never calls WriteHeader
+
+		next.ServeHTTP(rec, r)
+
+		route := metricsRoute(r.Pattern)
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsRoute turns a mux pattern ("GET /api/chirps/{chirpID}") into the route label ("/api/chirps/{chirpID}").
+// Requests that matched nothing all share one label: using the raw path would give every scanner probe its own series.
+func metricsRoute(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// timedDB is a database.DBTX that records how long each query takes in dbQueryDuration.
+// Rows are timed up to the point they start coming back, not until they've all been read.
+type timedDB struct {
+	db        database.DBTX
+	durations *prometheus.HistogramVec
+}
+
+// instrumentDB wraps db (the pool, or a transaction) so its queries show up in chirpy_db_query_duration_seconds
+func (m *metrics) instrumentDB(db database.DBTX) database.DBTX {
+	return timedDB{db: db, durations: m.dbQueryDuration}
+}
+
+func (t timedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer t.observe(query, time.Now())
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+func (t timedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.db.PrepareContext(ctx, query)
+}
+
+func (t timedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer t.observe(query, time.Now())
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+func (t timedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer t.observe(query, time.Now())
+	return t.db.QueryRowContext(ctx, query, args...)
+}
+
+func (t timedDB) observe(query string, start time.Time) {
+	t.durations.WithLabelValues(queryName(query)).Observe(time.Since(start).Seconds())
+}
+
+// queryName pulls the name out of the "-- name: GetChirps :many" comment sqlc starts every query with
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "other"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
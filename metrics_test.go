@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	db := newMockDB()
+	_, token := createTestUser(t, db, "hank@dea.gov", "minerals")
+	cfg := newTestConfig(db)
+	cfg.introspectionAPIKey = "scrape-key"
+	server := newTestServer(cfg)
+	defer server.Close()
+
+	// not for just anyone: a user's token doesn't get in either
+	for _, bearer := range []string{"", token} {
+		resp := doRequest(t, "GET", server.URL+"/metrics", "", bearer)
+		resp.Body.Close()
+		if resp.StatusCode != 401 {
+			t.Errorf("expected status: 401, got: %v", resp.StatusCode)
+		}
+	}
+
+	for _, path := range []string{"/api/chirps", "/api/chirps", "/api/chirps/" + uuid.NewString(), "/api/nope", "/app/"} {
+		resp := doRequest(t, "GET", server.URL+path, "", token)
+		resp.Body.Close()
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/metrics", nil)
+	req.Header.Set("Authorization", "ApiKey scrape-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("error sending request: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status: 200, got: %v", resp.StatusCode)
+	}
+
+	want := []string{
+		`chirpy_http_requests_total{method="GET",route="/api/chirps",status="200"} 2`,
+		`chirpy_http_requests_total{method="GET",route="/api/chirps/{chirpID}",status="404"} 1`, // the pattern, not the ID
+		`chirpy_http_requests_total{method="GET",route="unmatched",status="404"} 1`,             // not the raw path
+		`chirpy_http_request_duration_seconds_count{method="GET",route="/api/chirps"} 2`,
+		`chirpy_fileserver_hits 1`,
+		`go_goroutines`,
+	}
+	for _, line := range want {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("expected /metrics to contain %q", line)
+		}
+	}
+}
+
+// fakeDBTX answers every query with nothing, for timing checks
+type fakeDBTX struct{}
+
+func (fakeDBTX) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (fakeDBTX) PrepareContext(context.Context, string) (*sql.Stmt, error) { return nil, nil }
+func (fakeDBTX) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+func (fakeDBTX) QueryRowContext(context.Context, string, ...interface{}) *sql.Row { return nil }
+
+func TestInstrumentDB(t *testing.T) {
+	cfg := newTestConfig(newMockDB())
+	db := cfg.metrics.instrumentDB(fakeDBTX{})
+
+	db.ExecContext(context.Background(), "-- name: DeleteChirp :exec\nDELETE FROM chirps WHERE id = $1")
+	db.QueryContext(context.Background(), "-- name: GetChirps :many\nSELECT ...")
+	db.QueryRowContext(context.Background(), "-- name: GetChirps :many\nSELECT ...")
+	db.ExecContext(context.Background(), "SELECT 1")
+
+	rec := httptest.NewRecorder()
+	cfg.metrics.handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`chirpy_db_query_duration_seconds_count{query="DeleteChirp"} 1`,
+		`chirpy_db_query_duration_seconds_count{query="GetChirps"} 2`,
+		`chirpy_db_query_duration_seconds_count{query="other"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("expected /metrics to contain %q", line)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// unexported key type, so nothing outside this package can collide with (or overwrite) our context values
+type contextKey string
+
+const (
+	requestIDKey contextKey = "requestID"
+	userIDKey    contextKey = "userID"
+	clientIPKey  contextKey = "clientIP"
+	serviceKey   contextKey = "service"
+)
+
+// middlewareRequestID makes sure every request carries an ID we can use to tie log lines together.
+// It reuses an incoming X-Request-ID header if the client (or a proxy) sent one, otherwise it generates
+// a fresh UUID. The ID is stored in the request context and echoed back in the response header.
+func middlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = uuid.NewString()
+		}
+
+		w.Header().Set("X-Request-ID", requestID) // must be set BEFORE the handler writes the status code
+
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestIDFromContext returns the request ID stored by middlewareRequestID, or "" if there isn't one.
+func requestIDFromContext(ctx context.Context) string {
+	requestID, ok := ctx.Value(requestIDKey).(string)
+	if !ok {
+		return ""
+	}
+	return requestID
+}
+
+// middlewareTrailingSlash redirects API paths with a trailing slash (e.g. "/api/chirps/") to the
+// canonical path without it ("/api/chirps"), since the mux treats them as different routes and
+// would otherwise 404. 308 (not 301) so POST/PUT clients resend the same method and body.
+// Only /api/ is touched - the fileservers under /app/ and /assets/ need their slashes.
+func middlewareTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if strings.HasPrefix(path, "/api/") && len(path) > len("/api/") && strings.HasSuffix(path, "/") {
+			target := strings.TrimRight(path, "/")
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// middlewareJSONNotFound makes unmatched /api/ requests fail with a JSON errResponse, like every other
+// API error, instead of the mux's plain-text "404 page not found" / "Method Not Allowed".
+// The mux still decides which of the two it is (and which methods go in the Allow header).
+func middlewareJSONNotFound(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		handler, pattern := mux.Handler(r)
+		if pattern != "" { // a real route - served by the mux itself, since only it fills in r.PathValue
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// no route: let the mux's own fallback run against a throwaway writer to see what it would send
+		fallback := &headerCapture{header: make(http.Header), status: http.StatusOK}
+		handler.ServeHTTP(fallback, r)
+		switch fallback.status {
+		case http.StatusNotFound:
+			respondWithError(w, 404, errCodeNotFound, "no such endpoint: "+r.URL.Path)
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", fallback.header.Get("Allow"))
+			respondWithError(w, 405, errCodeMethodNotAllowed, r.Method+" isn't supported here (allowed: "+fallback.header.Get("Allow")+")")
+		default: // e.g. a redirect to the cleaned-up path - nothing to convert, so send the real thing
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// headerCapture is a ResponseWriter that remembers the headers and status code and throws the body away
+type headerCapture struct {
+	header http.Header
+	status int
+}
+
+func (c *headerCapture) Header() http.Header         { return c.header }
+func (c *headerCapture) Write(b []byte) (int, error) { return len(b), nil }
+func (c *headerCapture) WriteHeader(code int)        { c.status = code }
+
+// statusRecorder wraps a ResponseWriter so we can find out which status code the handler sent
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack passes through to the real ResponseWriter. Without it, wrapping hides http.Hijacker
+// and WebSocket upgrades (GET /api/ws) fail.
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer doesn't support hijacking")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush passes through too, so streamed responses (GET /api/chirps/export) go out as they're written
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// middlewareLogging writes one log line per request, including the request ID and client IP.
+// It needs to sit INSIDE middlewareRequestID and middlewareClientIP so those are already in the context.
+func middlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK} // 200 if the handler never calls WriteHeader
+
+		next.ServeHTTP(rec, r)
+
+		slog.InfoContext(r.Context(), "request",
+			"request_id", requestIDFromContext(r.Context()),
+			"client_ip", clientIP(r),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// middlewareAuth only lets requests through if they carry a valid access token (JWT) that an admin
+// hasn't revoked, responding 401 otherwise (see accessToken for where it's looked for, and
+// sessionDenylist for revocation). The authenticated user's ID is stored
+// in the request context - handlers get it back with userIDFromContext - and their last_seen_at is
+// bumped (see sawUser).
+func (cfg *apiConfig) middlewareAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := cfg.accessToken(r)
+		if err != nil {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		info, err := cfg.validateAccessToken(token)
+		if err != nil {
+			// a good service token is still no good here: everything behind middlewareAuth acts as a user
+			if _, serviceErr := cfg.jwtKeys.ValidateServiceJWT(token, cfg.audience); serviceErr == nil {
+				respondWithError(w, 403, errCodeForbidden, "this endpoint needs a user's token, not a service's")
+				return
+			}
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+		if !cfg.respondIfInactive(w, r, info.UserID) {
+			return
+		}
+
+		cfg.sawUser(info.UserID)
+		ctx := context.WithValue(r.Context(), userIDKey, info.UserID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// middlewareOptionalAuth is middlewareAuth for routes that also work logged out (like reading chirps):
+// no token at all just means an anonymous request, but a token that's there and invalid still gets 401,
+// so a client with an expired token finds out instead of silently seeing less. A service token gets the
+// anonymous view too, with the service account available from serviceFromContext.
+func (cfg *apiConfig) middlewareOptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := cfg.accessToken(r)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		info, err := cfg.validateAccessToken(token)
+		if err != nil {
+			if service, serviceErr := cfg.validateServiceToken(r.Context(), token); serviceErr == nil {
+				next(w, r.WithContext(context.WithValue(r.Context(), serviceKey, service)))
+				return
+			}
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+		if !cfg.respondIfInactive(w, r, info.UserID) {
+			return
+		}
+
+		cfg.sawUser(info.UserID)
+		ctx := context.WithValue(r.Context(), userIDKey, info.UserID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// respondIfInactive checks that the token's user hasn't deactivated their account (see checkAccountActive),
+// answering 401 if they have, or the database error if it couldn't tell. It returns false when it answered.
+func (cfg *apiConfig) respondIfInactive(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	err := cfg.checkAccountActive(r.Context(), userID)
+	if errors.Is(err, errAccountDeactivated) {
+		respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+		return false
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, r, "error checking account", err, "user_id", userID)
+		return false
+	}
+	return true
+}
+
+// accessToken finds the request's access token: the Authorization header if there is one,
+// otherwise the cookie login sets for browser clients (POST /api/login?set_cookie=true).
+func (cfg *apiConfig) accessToken(r *http.Request) (string, error) {
+	if r.Header.Get("Authorization") != "" {
+		return auth.GetBearerToken(r.Header)
+	}
+	cookie, err := r.Cookie(cfg.authCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", fmt.Errorf("no access token in Authorization header or %s cookie", cfg.authCookieName)
+	}
+	return cookie.Value, nil
+}
+
+// userIDFromContext returns the user ID stored by middlewareAuth.
+// ok is false if the request didn't go through middlewareAuth.
+func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	userID, ok := ctx.Value(userIDKey).(uuid.UUID)
+	return userID, ok
+}
+
+// middlewareRequireAdmin is middlewareAuth plus a check that the user is an admin (is_admin in the database).
+// Missing/invalid tokens get 401, valid tokens for non-admins get 403.
+func (cfg *apiConfig) middlewareRequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return cfg.middlewareAuth(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := userIDFromContext(r.Context())
+		admin, err := cfg.isAdmin(r.Context(), userID)
+		if err != nil {
+			cfg.respondWithDBError(w, r, "error checking admin", err, "user_id", userID)
+			return
+		}
+		if !admin {
+			respondWithError(w, 403, errCodeForbidden, "admin access required")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// middlewareRequireAPIKey only lets through other services that send "Authorization: ApiKey <key>" with
+// the key from INTROSPECTION_API_KEY. With no key configured nobody gets through, rather than everybody.
+// A service account's bearer token with the given scope does too (see middlewareServiceAuth).
+func (cfg *apiConfig) middlewareRequireAPIKey(scope string, next http.HandlerFunc) http.HandlerFunc {
+	serviceAuth := cfg.middlewareServiceAuth(scope, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := auth.GetBearerToken(r.Header); err == nil {
+			serviceAuth(w, r)
+			return
+		}
+		key, err := auth.GetAPIKey(r.Header)
+		// constant time, so the key can't be guessed a character at a time from how long a wrong one takes
+		if err != nil || cfg.introspectionAPIKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.introspectionAPIKey)) != 1 {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin looks the user up and reports whether they're an admin.
+// The flag is read from the database each time (not baked into the JWT), so revoking admin takes effect immediately.
+// A user that's gone isn't one; any other error is returned, so an outage isn't mistaken for "not an admin".
+func (cfg *apiConfig) isAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	dbUser, err := withRetry(dbCtx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return dbUser.IsAdmin, nil
+}
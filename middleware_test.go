@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareTrailingSlash(t *testing.T) {
+	handler := middlewareTrailingSlash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	cases := []struct {
+		path         string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"/api/chirps", 200, ""},
+		{"/api/chirps/", 308, "/api/chirps"},
+		{"/api/chirps/?author_id=abc", 308, "/api/chirps?author_id=abc"},
+		{"/api/chirps/1234/", 308, "/api/chirps/1234"},
+		{"/api/chirps/1234", 200, ""},
+		{"/api/", 200, ""},         // nothing to trim down to
+		{"/app/", 200, ""},         // fileserver paths keep their slash
+		{"/assets/logo/", 200, ""}, // ditto
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != c.wantStatus {
+			t.Errorf("%s: expected status: %v, got: %v", c.path, c.wantStatus, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != c.wantLocation {
+			t.Errorf("%s: expected location: %q, got: %q", c.path, c.wantLocation, got)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+
+	"github.com/pressly/goose/v3"
+)
+
+// The goose migration files get compiled INTO the binary, so a deploy doesn't
+// need the sql/ directory sitting next to it.
+//
+//go:embed sql/schema/*.sql
+var embedMigrations embed.FS
+
+// runMigrations applies any pending "up" migrations and logs each version it applied.
+func runMigrations(ctx context.Context, db *sql.DB) error {
+	schemaFS, err := fs.Sub(embedMigrations, "sql/schema") // goose wants the migrations at the root of the FS
+	if err != nil {
+		return fmt.Errorf("error loading embedded migrations: %w", err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, schemaFS)
+	if err != nil {
+		return fmt.Errorf("error creating migration provider: %w", err)
+	}
+
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("error applying migrations: %w", err)
+	}
+
+	for _, result := range results {
+		slog.Info("applied migration", "version", result.Source.Version, "file", result.Source.Path, "duration", result.Duration)
+	}
+
+	version, err := provider.GetDBVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+	slog.Info("database schema up to date", "version", version, "applied", len(results))
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChirpModerator decides whether a chirp may be posted at all (censor only masks words, it never refuses).
+// saveChirp asks it after validation and the duplicate check, so an implementation that calls out to something
+// slow or paid (e.g. an external classifier) never sees chirps we'd reject anyway.
+// A rejection's reason is shown to the author, so keep it short and human-readable.
+type ChirpModerator interface {
+	Moderate(ctx context.Context, body string) (allowed bool, reason string, err error)
+}
+
+// allowAllModerator lets everything through. It's the default (CHIRP_MODERATOR unset or "none").
+type allowAllModerator struct{}
+
+func (allowAllModerator) Moderate(ctx context.Context, body string) (bool, string, error) {
+	return true, "", nil
+}
+
+// profanityModerator rejects chirps containing any of our banned words outright,
+// instead of letting censor mask them (CHIRP_MODERATOR=profanity).
+type profanityModerator struct{}
+
+func (profanityModerator) Moderate(ctx context.Context, body string) (bool, string, error) {
+	for _, word := range strings.Split(body, " ") { // split the same way filterProfanity does
+		if isProfane(word) {
+			return false, "chirp contains a banned word", nil
+		}
+	}
+	return true, "", nil
+}
+
+// parseChirpModerator turns a config string into a ChirpModerator. Empty means "none".
+func parseChirpModerator(name string) (ChirpModerator, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return allowAllModerator{}, nil
+	case "profanity":
+		return profanityModerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown chirp moderator %q (want none or profanity)", name)
+	}
+}
+
+// chirpRejectedError is what saveChirp returns when the moderator says no
+type chirpRejectedError struct {
+	reason string
+}
+
+func (e *chirpRejectedError) Error() string {
+	return "chirp rejected by moderation: " + e.reason
+}
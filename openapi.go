@@ -0,0 +1,27 @@
+package main
+
+import (
+	"embed"
+	"log/slog"
+	"net/http"
+)
+
+// The OpenAPI document is written by hand (api/openapi.json) and compiled into the binary.
+// When you add or change an endpoint, update the document too!
+//
+//go:embed api/openapi.json
+var apiDocs embed.FS
+
+// GET /api/openapi.json - describes the API so clients can discover it (or generate code from it)
+func serveOpenAPI(w http.ResponseWriter, req *http.Request) {
+	spec, err := apiDocs.ReadFile("api/openapi.json")
+	if err != nil {
+		slog.Error("error reading embedded openapi document", "error", err)
+		respondWithError(w, 500, errCodeInternal, "error loading API document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(spec)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIDocument makes sure the embedded document is valid JSON and mentions every endpoint.
+// If this fails after adding a route, add the route to api/openapi.json (and to the list below).
+func TestOpenAPIDocument(t *testing.T) {
+	spec, err := apiDocs.ReadFile("api/openapi.json")
+	if err != nil {
+		t.Fatalf("error reading embedded document: %v", err)
+	}
+
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatalf("openapi.json isn't valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got version: %v", doc.OpenAPI)
+	}
+
+	routes := []string{
+		"GET /api/healthz",
+		"GET /api/readyz",
+		"GET /api/version",
+		"GET /api/openapi.json",
+		"POST /api/users",
+		"PATCH /api/users",
+		"DELETE /api/users",
+		"POST /api/users/email/confirm",
+		"POST /api/users/email/resend",
+		"POST /api/login",
+		"GET /api/whoami",
+		"POST /api/introspect",
+		"POST /api/token",
+		"DELETE /api/me/chirps",
+		"POST /api/me/pin",
+		"DELETE /api/me/pin",
+		"GET /api/me/settings",
+		"PUT /api/me/settings",
+		"GET /api/users/available",
+		"GET /api/users/{userID}/stats",
+		"GET /api/chirps",
+		"HEAD /api/chirps",
+		"POST /api/chirps",
+		"GET /api/chirps/random",
+		"GET /api/chirps/export",
+		"GET /api/chirps/{chirpID}",
+		"PUT /api/chirps/{chirpID}",
+		"DELETE /api/chirps/{chirpID}",
+		"GET /api/chirps/{chirpID}/links",
+		"GET /api/chirps/{chirpID}/history",
+		"POST /api/chirps/{chirpID}/report",
+		"POST /api/chirps/{chirpID}/publish",
+		"GET /api/ws",
+		"GET /metrics",
+		"GET /admin/metrics",
+		"POST /admin/reset",
+		"POST /admin/maintenance",
+		"POST /admin/refilter",
+		"GET /admin/reports",
+		"POST /admin/users/{userID}/revoke",
+		"DELETE /admin/users/{userID}/chirps",
+		"POST /admin/service-accounts",
+		"DELETE /admin/service-accounts/{clientID}",
+	}
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %v is missing from openapi.json", route)
+		}
+	}
+}
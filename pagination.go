@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultChirpPageSize = 20
+	maxChirpPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// ChirpPage is GET /api/chirps when it's paginated (?limit= and/or ?before=)
+type ChirpPage struct {
+	Chirps []Chirp  `json:"chirps"`
+	Meta   PageMeta `json:"meta"`
+}
+
+type PageMeta struct {
+	NextCursor *string `json:"next_cursor"` // pass as ?before= for the next page; null on the last one
+}
+
+// chirpCursor marks a position in the newest-first list: the last chirp on the previous page.
+// Keyset rather than offset, so chirps posted while someone pages through don't shift or repeat what they see.
+type chirpCursor struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+// encode makes the cursor opaque to clients, so we can change what's in it later
+func (c chirpCursor) encode() string {
+	raw := c.createdAt.UTC().Format(time.RFC3339Nano) + "|" + c.id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeChirpCursor(s string) (chirpCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	createdAtString, idString, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return chirpCursor{}, errInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtString)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return chirpCursor{}, errInvalidCursor
+	}
+	return chirpCursor{createdAt: createdAt, id: id}, nil
+}
+
+// isPageRequest reports whether GET /api/chirps was asked for a page rather than the whole (oldest first) list
+func isPageRequest(req *http.Request) bool {
+	query := req.URL.Query()
+	return query.Has("limit") || query.Has("before")
+}
+
+// chirpPage is what a paginated GET /api/chirps asked for with ?limit= and ?before=
+type chirpPage struct {
+	size   int
+	cursor *chirpCursor // nil for the first page
+}
+
+// parseChirpPage reads ?limit= (default 20, max 100) and ?before=. Its errors are fit to show the client.
+func parseChirpPage(query url.Values) (chirpPage, error) {
+	page := chirpPage{size: defaultChirpPageSize}
+	if limitParam := query.Get("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxChirpPageSize {
+			return chirpPage{}, errors.New("limit must be between 1 and " + strconv.Itoa(maxChirpPageSize))
+		}
+		page.size = limit
+	}
+	if before := query.Get("before"); before != "" {
+		cursor, err := decodeChirpCursor(before)
+		if err != nil {
+			return chirpPage{}, err
+		}
+		page.cursor = &cursor
+	}
+	return page, nil
+}
+
+// respondWithChirpPage answers a paginated GET /api/chirps: up to page.size chirps, newest first (unless
+// ?sort=asc), starting after page.cursor from the previous page (or from the start).
+// A cursor only makes sense with the same filters and sort as the page it came from.
+func (cfg *apiConfig) respondWithChirpPage(w http.ResponseWriter, req *http.Request, viewer uuid.NullUUID, filter chirpFilter, page chirpPage, loc *time.Location) {
+	pageSize := page.size
+	params := database.GetChirpsAfterCursorParams{
+		ViewerID:    viewer,
+		Lang:        filter.lang,
+		AuthorID:    filter.authorID,
+		BodyPattern: filter.bodyPattern,
+		PageSize:    int32(pageSize + 1), // one extra, to find out whether there's another page after this one
+	}
+	if page.cursor != nil {
+		params.CursorCreatedAt = sql.NullTime{Time: page.cursor.createdAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: page.cursor.id, Valid: true}
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbChirps, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.Chirp, error) {
+		if filter.newestFirst { // each order has its own query, see GetChirpsNewestFirst
+			return cfg.db.GetChirpsBeforeCursor(ctx, database.GetChirpsBeforeCursorParams(params))
+		}
+		return cfg.db.GetChirpsAfterCursor(ctx, params)
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error retrieving chirps", err)
+		return
+	}
+
+	resp := ChirpPage{Chirps: []Chirp{}} // [] rather than null for an empty page
+	if len(dbChirps) > pageSize {
+		dbChirps = dbChirps[:pageSize]
+		last := dbChirps[len(dbChirps)-1]
+		next := chirpCursor{createdAt: last.CreatedAt, id: last.ID}.encode()
+		resp.Meta.NextCursor = &next
+	}
+	for _, chirp := range dbChirps {
+		resp.Chirps = append(resp.Chirps, chirpFromDB(chirp).inTimezone(loc))
+	}
+	jsonWriter(w, 200, resp)
+}
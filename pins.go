@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type PinChirpRequest struct {
+	ChirpID string `json:"chirp_id"`
+}
+
+// pinnedChirpID is the User.PinnedChirpID for a database user: nil when nothing is pinned
+func pinnedChirpID(dbUser database.User) *uuid.UUID {
+	if !dbUser.PinnedChirpID.Valid {
+		return nil
+	}
+	return &dbUser.PinnedChirpID.UUID
+}
+
+// POST /api/me/pin - pins one of your own chirps to the top of your profile, replacing any earlier pin.
+// Responds with the updated user.
+func (cfg *apiConfig) middlewareMetricsPinChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	params := PinChirpRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+	chirpUUID, err := uuid.Parse(params.ChirpID)
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	// someone else's private chirp is a 404 like everywhere else, so this can't be used to find out it exists
+	if err != nil || !canView(dbChirp, uuid.NullUUID{UUID: userID, Valid: true}) {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+	if dbChirp.UserID != userID {
+		respondWithError(w, 403, errCodeForbidden, "you can only pin your own chirps")
+		return
+	}
+
+	cfg.setPinnedChirp(w, req, userID, uuid.NullUUID{UUID: chirpUUID, Valid: true})
+}
+
+// DELETE /api/me/pin - unpins whatever is pinned (if anything). Responds with the updated user.
+func (cfg *apiConfig) middlewareMetricsUnpinChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+	cfg.setPinnedChirp(w, req, userID, uuid.NullUUID{})
+}
+
+// setPinnedChirp stores the pin (or clears it, if chirpID isn't Valid) and responds with the user
+func (cfg *apiConfig) setPinnedChirp(w http.ResponseWriter, req *http.Request, userID uuid.UUID, chirpID uuid.NullUUID) {
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	dbUser, err := cfg.db.SetPinnedChirp(ctx, database.SetPinnedChirpParams{
+		PinnedChirpID: chirpID,
+		ID:            userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) { // token for a user that's since been deleted
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error pinning chirp", err, "user_id", userID, "chirp_id", chirpID.UUID)
+		return
+	}
+
+	jsonWriter(w, 200, userFromDB(dbUser))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// profanityStyle picks how filterProfanity censors a banned word
+type profanityStyle string
+
+const (
+	profanityStyleMask          profanityStyle = "mask"          // kerfuffle -> ****
+	profanityStyleFirstLetter   profanityStyle = "first_letter"  // kerfuffle -> k***
+	profanityStyleStrikethrough profanityStyle = "strikethrough" // kerfuffle -> ~~kerfuffle~~ (markdown)
+)
+
+// parseProfanityStyle turns a config string into a profanityStyle. Empty means the default (mask).
+func parseProfanityStyle(style string) (profanityStyle, error) {
+	switch profanityStyle(strings.ToLower(style)) {
+	case "", profanityStyleMask:
+		return profanityStyleMask, nil
+	case profanityStyleFirstLetter:
+		return profanityStyleFirstLetter, nil
+	case profanityStyleStrikethrough:
+		return profanityStyleStrikethrough, nil
+	default:
+		return "", fmt.Errorf("unknown profanity style %q (want mask, first_letter or strikethrough)", style)
+	}
+}
+
+// profanityMatch picks what filterProfanity counts as a banned word
+type profanityMatch string
+
+const (
+	profanityMatchWord      profanityMatch = "word"      // whole words only: "kerfuffle" yes, "kerfuffles" no
+	profanityMatchSubstring profanityMatch = "substring" // inside other words too: "kerfuffles" -> "****s"
+)
+
+// parseProfanityMatch turns a config string into a profanityMatch. Empty means the default (word).
+// Substring matching is opt-in because it censors innocent words that happen to contain a banned one
+// (the "Scunthorpe problem") - only worth it if people are dodging the filter with compound words.
+func parseProfanityMatch(match string) (profanityMatch, error) {
+	switch profanityMatch(strings.ToLower(match)) {
+	case "", profanityMatchWord:
+		return profanityMatchWord, nil
+	case profanityMatchSubstring:
+		return profanityMatchSubstring, nil
+	default:
+		return "", fmt.Errorf("unknown profanity match %q (want word or substring)", match)
+	}
+}
+
+// censor runs filterProfanity on a chirp body, unless filtering is switched off for this deployment
+func (cfg *apiConfig) censor(body string) string {
+	if !cfg.filterProfanity {
+		return body
+	}
+	return filterProfanity(body, cfg.profanityStyle, cfg.profanityMatch)
+}
+
+// defaultProfanity is the banned word list when neither PROFANITY_FILE nor PROFANITY_WORDS is set
+var defaultProfanity = []string{"kerfuffle", "sharbert", "fornax"}
+
+// profanity holds the banned words, shared by filterProfanity and profanityModerator. It's swapped
+// whole rather than edited, since a SIGHUP can replace it while requests are reading it.
+var profanity atomic.Pointer[[]string]
+
+// bannedWords is the current banned word list (the defaults until setProfanity says otherwise)
+func bannedWords() []string {
+	if words := profanity.Load(); words != nil {
+		return *words
+	}
+	return defaultProfanity
+}
+
+func setProfanity(words []string) {
+	profanity.Store(&words)
+}
+
+// loadProfanity picks the banned word list at startup: the file at path (PROFANITY_FILE) if there is one,
+// otherwise the comma-separated words (PROFANITY_WORDS), otherwise defaultProfanity.
+func loadProfanity(path, words string) ([]string, error) {
+	if path != "" {
+		return readProfanityFile(path)
+	}
+	if strings.TrimSpace(words) == "" {
+		return defaultProfanity, nil
+	}
+	var list []string
+	for _, word := range strings.Split(words, ",") {
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		if strings.ContainsAny(word, " \t") {
+			return nil, fmt.Errorf("PROFANITY_WORDS: %q isn't a single word", word)
+		}
+		list = append(list, strings.ToLower(word))
+	}
+	if len(list) == 0 {
+		return nil, errors.New("PROFANITY_WORDS has no words in it")
+	}
+	return list, nil
+}
+
+// readProfanityFile reads a banned word list, one word per line. Blank lines and anything after a # are ignored.
+func readProfanityFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PROFANITY_FILE: %w", err)
+	}
+	defer f.Close()
+
+	var list []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		word, _, _ := strings.Cut(scanner.Text(), "#")
+		word = strings.TrimSpace(word)
+		if word == "" {
+			continue
+		}
+		if strings.ContainsAny(word, " \t") {
+			// filterProfanity looks at one word at a time, so a phrase would never match
+			return nil, fmt.Errorf("%s line %d: %q isn't a single word", path, line, word)
+		}
+		list = append(list, strings.ToLower(word))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading PROFANITY_FILE: %w", err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s has no words in it (set FILTER_PROFANITY=false to turn the filter off)", path)
+	}
+	return list, nil
+}
+
+// reloadProfanityOnHangup re-reads the PROFANITY_FILE at path each time the process gets a SIGHUP, until
+// ctx is done. A file that doesn't load is logged and the current list kept. Chirps already stored stay as
+// they were; POST /admin/refilter runs them through the new list.
+func reloadProfanityOnHangup(ctx context.Context, path string) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		words, err := readProfanityFile(path)
+		if err != nil {
+			slog.Error("error reloading profanity list, keeping the current one", "error", err)
+			continue
+		}
+		setProfanity(words)
+		slog.Info("reloaded profanity list", "path", path, "words", len(words))
+	}
+}
+
+func filterProfanity(body string, style profanityStyle, match profanityMatch) string {
+	wordSlice := strings.Split(body, " ")
+
+	for i, word := range wordSlice {
+		if match == profanityMatchSubstring {
+			wordSlice[i] = censorSubstrings(word, style)
+		} else if isProfane(word) {
+			wordSlice[i] = censorWord(word, style) // NEED TO USE INDEX! Otherwise, word is a *copy* of the value
+		}
+	}
+
+	return strings.Join(wordSlice, " ")
+}
+
+// censorSubstrings censors every banned word inside word, leaving the rest of it alone
+// ("KERFUFFLEd" -> "****d" with the mask style). Matching ignores case. The strikethrough style keeps
+// the banned word, so spans it has already struck through are skipped - otherwise every run of the
+// filter would wrap them again.
+func censorSubstrings(word string, style profanityStyle) string {
+	words := bannedWords()
+	var censored strings.Builder
+	for i := 0; i < len(word); {
+		if style == profanityStyleStrikethrough && strings.HasPrefix(word[i:], "~~") {
+			if end := strings.Index(word[i+2:], "~~"); end >= 0 {
+				end += i + 4
+				censored.WriteString(word[i:end])
+				i = end
+				continue
+			}
+		}
+		matched := false
+		for _, profane := range words {
+			// only ever a len(profane)-byte match: a banned word whose other case is a different
+			// length in UTF-8 (rare, and never for ASCII) is only caught in the case it was listed in
+			end := i + len(profane)
+			if end <= len(word) && strings.EqualFold(word[i:end], profane) {
+				censored.WriteString(censorWord(word[i:end], style))
+				i = end
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			censored.WriteByte(word[i])
+			i++
+		}
+	}
+	return censored.String()
+}
+
+// isProfane reports whether word is one of the banned words, ignoring case
+func isProfane(word string) bool {
+	for _, profane := range bannedWords() {
+		if strings.ToLower(word) == profane {
+			return true
+		}
+	}
+	return false
+}
+
+// censorWord applies style to a single banned word
+func censorWord(word string, style profanityStyle) string {
+	switch style {
+	case profanityStyleFirstLetter:
+		firstLetter := []rune(word)[0] // runes, not bytes, so we never cut a multi-byte character in half
+		return string(firstLetter) + "***"
+	case profanityStyleStrikethrough:
+		return "~~" + word + "~~"
+	default:
+		return "****"
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFilterProfanityStyles(t *testing.T) {
+	body := "what a Kerfuffle, no really a kerfuffle and a sharbert"
+
+	cases := []struct {
+		style profanityStyle
+		want  string
+	}{
+		{profanityStyleMask, "what a Kerfuffle, no really a **** and a ****"},
+		{profanityStyleFirstLetter, "what a Kerfuffle, no really a k*** and a s***"},
+		{profanityStyleStrikethrough, "what a Kerfuffle, no really a ~~kerfuffle~~ and a ~~sharbert~~"},
+	}
+
+	for _, c := range cases {
+		got := filterProfanity(body, c.style, profanityMatchWord)
+		if got != c.want {
+			t.Errorf("style %v: expected: %v, got: %v", c.style, c.want, got)
+		}
+	}
+
+	// the whole-word match is case-insensitive, and the first-letter style keeps the original case
+	got := filterProfanity("Fornax", profanityStyleFirstLetter, profanityMatchWord)
+	if got != "F***" {
+		t.Errorf("expected: F***, got: %v", got)
+	}
+}
+
+func TestFilterProfanityMatch(t *testing.T) {
+	body := "such kerfuffles, a SHARBERTfest and a fornax"
+
+	cases := []struct {
+		match profanityMatch
+		style profanityStyle
+		want  string
+	}{
+		// whole words: only the exact "fornax" goes
+		{profanityMatchWord, profanityStyleMask, "such kerfuffles, a SHARBERTfest and a ****"},
+		// substrings: just the banned part of each word is censored, the rest is left alone
+		{profanityMatchSubstring, profanityStyleMask, "such ****s, a ****fest and a ****"},
+		{profanityMatchSubstring, profanityStyleFirstLetter, "such k***s, a S***fest and a f***"},
+		{profanityMatchSubstring, profanityStyleStrikethrough, "such ~~kerfuffle~~s, a ~~SHARBERT~~fest and a ~~fornax~~"},
+	}
+
+	for _, c := range cases {
+		got := filterProfanity(body, c.style, c.match)
+		if got != c.want {
+			t.Errorf("match %v, style %v: expected: %v, got: %v", c.match, c.style, c.want, got)
+		}
+		// filtering what's already been filtered changes nothing, which POST /admin/refilter relies on
+		if again := filterProfanity(got, c.style, c.match); again != got {
+			t.Errorf("match %v, style %v: filtering twice: expected: %v, got: %v", c.match, c.style, got, again)
+		}
+	}
+
+	// non-ASCII text around a match survives intact
+	got := filterProfanity("¡fornaxé!", profanityStyleMask, profanityMatchSubstring)
+	if got != "¡****é!" {
+		t.Errorf("expected: ¡****é!, got: %v", got)
+	}
+}
+
+func TestParseProfanityMatch(t *testing.T) {
+	match, err := parseProfanityMatch("")
+	if err != nil || match != profanityMatchWord {
+		t.Errorf("expected default word match, got: %v and %v", match, err)
+	}
+
+	match, err = parseProfanityMatch("Substring")
+	if err != nil || match != profanityMatchSubstring {
+		t.Errorf("expected substring match, got: %v and %v", match, err)
+	}
+
+	if _, err := parseProfanityMatch("fuzzy"); err == nil {
+		t.Errorf("expected error for unknown match, got none")
+	}
+}
+
+func TestParseProfanityStyle(t *testing.T) {
+	style, err := parseProfanityStyle("")
+	if err != nil || style != profanityStyleMask {
+		t.Errorf("expected default mask style, got: %v and %v", style, err)
+	}
+
+	style, err = parseProfanityStyle("Strikethrough")
+	if err != nil || style != profanityStyleStrikethrough {
+		t.Errorf("expected strikethrough style, got: %v and %v", style, err)
+	}
+
+	if _, err := parseProfanityStyle("bleep"); err == nil {
+		t.Errorf("expected error for unknown style, got none")
+	}
+}
+
+func TestParseChirpModerator(t *testing.T) {
+	moderator, err := parseChirpModerator("")
+	if _, ok := moderator.(allowAllModerator); err != nil || !ok {
+		t.Errorf("expected default allow-all moderator, got: %T and %v", moderator, err)
+	}
+
+	moderator, err = parseChirpModerator("Profanity")
+	if _, ok := moderator.(profanityModerator); err != nil || !ok {
+		t.Errorf("expected profanity moderator, got: %T and %v", moderator, err)
+	}
+
+	if _, err := parseChirpModerator("vibes"); err == nil {
+		t.Errorf("expected error for unknown moderator, got none")
+	}
+}
+
+func TestLoadProfanity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profanity.txt")
+	list := "# house rules\n\nKerfuffle\n  gorgonzola  # too strong\nsmeg\n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	words, err := loadProfanity(path, "ignored,when,theres,a,file")
+	if err != nil || !slices.Equal(words, []string{"kerfuffle", "gorgonzola", "smeg"}) {
+		t.Errorf("file: expected kerfuffle, gorgonzola and smeg, got: %v and %v", words, err)
+	}
+
+	words, err = loadProfanity("", " Gorgonzola, smeg ,")
+	if err != nil || !slices.Equal(words, []string{"gorgonzola", "smeg"}) {
+		t.Errorf("PROFANITY_WORDS: expected gorgonzola and smeg, got: %v and %v", words, err)
+	}
+
+	words, err = loadProfanity("", "")
+	if err != nil || !slices.Equal(words, defaultProfanity) {
+		t.Errorf("neither: expected the defaults, got: %v and %v", words, err)
+	}
+
+	bad := map[string]string{
+		"missing":  filepath.Join(t.TempDir(), "missing.txt"),
+		"empty":    path + ".empty",
+		"a phrase": path + ".phrase",
+	}
+	if err := os.WriteFile(bad["empty"], []byte("# nothing yet\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bad["a phrase"], []byte("smeg head\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, badPath := range bad {
+		if _, err := loadProfanity(badPath, ""); err == nil {
+			t.Errorf("%s: expected error, got none", name)
+		}
+	}
+
+	// once it's in use, the filter and the moderator both go by the new list
+	t.Cleanup(func() { setProfanity(defaultProfanity) })
+	setProfanity([]string{"gorgonzola"})
+	if got := filterProfanity("some Gorgonzola and a kerfuffle", profanityStyleMask, profanityMatchWord); got != "some **** and a kerfuffle" {
+		t.Errorf("expected only gorgonzola censored, got: %v", got)
+	}
+	if allowed, _, _ := (profanityModerator{}).Moderate(context.Background(), "gorgonzola"); allowed {
+		t.Errorf("expected the moderator to reject gorgonzola")
+	}
+}
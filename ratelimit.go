@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each key (a client IP) up to limit requests per fixed window. Like sessionDenylist
+// it lives in memory, so every instance counts separately and a restart starts everyone afresh - fine
+// for slowing down a script, not a hard quota.
+type rateLimiter struct {
+	mu      sync.Mutex
+	windows map[string]rateWindow
+	limit   int
+	window  time.Duration
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{windows: make(map[string]rateWindow), limit: limit, window: window}
+}
+
+// rateStatus is where a key stands after a request: whether it was let through, how many more its
+// window allows, and when that window resets
+type rateStatus struct {
+	ok        bool
+	remaining int
+	reset     time.Time
+}
+
+// allow counts a request from key at now
+func (l *rateLimiter) allow(key string, now time.Time) rateStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, found := l.windows[key]
+	if !found || now.Sub(w.start) >= l.window {
+		l.prune(now)
+		w = rateWindow{start: now}
+	}
+	reset := w.start.Add(l.window)
+	if w.count >= l.limit {
+		return rateStatus{ok: false, remaining: 0, reset: reset}
+	}
+	w.count++
+	l.windows[key] = w
+	return rateStatus{ok: true, remaining: l.limit - w.count, reset: reset}
+}
+
+// prune drops windows that have run out, so the map doesn't grow with every address we've ever seen. Caller holds mu.
+func (l *rateLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// middlewareRateLimit tells every client where it stands with X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (a Unix time, in seconds), so well-behaved ones can pace themselves. Once a client IP
+// has used up its allowance it answers 429, with Retry-After in whole seconds.
+func middlewareRateLimit(limiter *rateLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		now := time.Now()
+		status := limiter.allow(clientIP(req), now)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.remaining))
+		resetSecond := status.reset.Add(time.Second - 1).Unix() // rounded up, so a client waiting for it isn't early
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(resetSecond, 10))
+		if !status.ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(status.reset.Sub(now).Seconds()))))
+			respondWithError(w, 429, errCodeRateLimited, "too many requests, slow down")
+			return
+		}
+		next(w, req)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2, time.Minute)
+	start := time.Now()
+
+	for i := 0; i < 2; i++ {
+		status := limiter.allow("10.0.0.1", start)
+		if !status.ok {
+			t.Fatalf("request %d: expected it to be allowed", i+1)
+		}
+		if status.remaining != 1-i {
+			t.Errorf("request %d: expected remaining: %d, got: %d", i+1, 1-i, status.remaining)
+		}
+	}
+	status := limiter.allow("10.0.0.1", start.Add(20*time.Second))
+	if status.ok {
+		t.Errorf("third request: expected it to be refused")
+	}
+	if status.remaining != 0 || !status.reset.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected remaining 0 and reset at %v, got: %d and %v", start.Add(time.Minute), status.remaining, status.reset)
+	}
+
+	if !limiter.allow("10.0.0.2", start).ok {
+		t.Errorf("another client: expected it to be allowed")
+	}
+
+	if !limiter.allow("10.0.0.1", start.Add(time.Minute)).ok {
+		t.Errorf("next window: expected it to be allowed")
+	}
+	if _, found := limiter.windows["10.0.0.2"]; found {
+		t.Errorf("expected the expired window to be pruned")
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	handler := middlewareRateLimit(newRateLimiter(1, time.Minute), func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 200 {
+		t.Fatalf("first request: expected status: 200, got: %v", rec.Code)
+	}
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("expected X-RateLimit-Limit: 1, got: %q", got)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("expected X-RateLimit-Remaining: 0, got: %q", got)
+	}
+	reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || reset < time.Now().Unix() || reset > time.Now().Add(time.Minute+time.Second).Unix() {
+		t.Errorf("expected X-RateLimit-Reset about a minute from now, got: %q", rec.Header().Get("X-RateLimit-Reset"))
+	}
+	if rec.Header().Get("Retry-After") != "" {
+		t.Errorf("expected no Retry-After on an allowed request")
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 429 {
+		t.Fatalf("second request: expected status: 429, got: %v", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("expected Retry-After and X-RateLimit-Remaining: 0, got: %v", rec.Header())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// how many chirps POST /admin/refilter reads and updates per transaction
+const refilterBatchSize = 100
+
+type RefilterSummary struct {
+	Checked int64 `json:"checked"`
+	Updated int64 `json:"updated"`
+}
+
+// POST /admin/refilter - runs every stored chirp back through the profanity filter (e.g. after the
+// word list changes) and saves any that come out different. Censored words don't match the list
+// any more (or, struck through, are skipped by censorSubstrings), so running it twice changes nothing
+// the second time.
+func (cfg *apiConfig) middlewareMetricsRefilterChirps(w http.ResponseWriter, req *http.Request) {
+	var summary RefilterSummary
+	lastID := uuid.Nil // chirps are walked in id order, one batch after another
+
+	for {
+		var batch []database.Chirp
+		var updatedIDs []uuid.UUID
+
+		err := cfg.withTx(req.Context(), func(q database.Querier) error {
+			ctx, cancel := cfg.dbContext(req.Context())
+			defer cancel()
+
+			var err error
+			batch, err = q.GetChirpsAfterID(ctx, database.GetChirpsAfterIDParams{
+				ID:    lastID,
+				Limit: refilterBatchSize,
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, chirp := range batch {
+				filtered := cfg.censor(chirp.Body)
+				if filtered == chirp.Body {
+					continue
+				}
+				// only replaces the body we just read, so an edit that lands in the meantime isn't overwritten
+				rows, err := q.ReplaceChirpBody(ctx, database.ReplaceChirpBodyParams{
+					ID:      chirp.ID,
+					OldBody: chirp.Body,
+					NewBody: filtered,
+				})
+				if err != nil {
+					return err
+				}
+				if rows > 0 {
+					updatedIDs = append(updatedIDs, chirp.ID)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			cfg.respondWithDBError(w, req, "error refiltering chirps", err, "checked", summary.Checked, "updated", summary.Updated)
+			return
+		}
+
+		// only once the batch has committed
+		for _, id := range updatedIDs {
+			cfg.chirpCache.Remove(id)
+		}
+		summary.Checked += int64(len(batch))
+		summary.Updated += int64(len(updatedIDs))
+
+		if len(batch) < refilterBatchSize {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+
+	slog.Info("chirps refiltered", "checked", summary.Checked, "updated", summary.Updated, "request_id", requestIDFromContext(req.Context()))
+	jsonWriter(w, 200, summary)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxReportReasonLength = 500 // characters; a reason, not an essay
+	reportedChirpsLimit   = 100 // how many chirps GET /admin/reports lists, most reported first
+)
+
+type ReportChirpRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReportedChirp is one entry in the admin moderation queue
+type ReportedChirp struct {
+	Chirp
+	ReportCount    int64     `json:"report_count"`
+	LastReportedAt Timestamp `json:"last_reported_at"`
+}
+
+// POST /api/chirps/{chirpID}/report - flags a chirp for the admins to look at.
+// Each user can only report a chirp once: the first report gets 201, and reporting it again is
+// a harmless no-op that gets 200 (the original reason is kept).
+func (cfg *apiConfig) middlewareMetricsReportChirp(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid chirp id")
+		return
+	}
+
+	params := ReportChirpRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+
+	reason := strings.TrimSpace(params.Reason)
+	if reason == "" {
+		respondWithError(w, 400, errCodeBadRequest, "reason can't be empty")
+		return
+	}
+	if len([]rune(reason)) > maxReportReasonLength {
+		respondWithError(w, 400, errCodeBadRequest, "reason is too long")
+		return
+	}
+
+	dbChirp, err := cfg.chirpCache.GetOrLoad(chirpUUID, func() (database.Chirp, error) {
+		ctx, cancel := cfg.dbContext(req.Context())
+		defer cancel()
+		return withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.Chirp, error) {
+			return cfg.db.GetChirpByChirpUUID(ctx, chirpUUID)
+		})
+	})
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		cfg.respondWithDBError(w, req, "error getting chirp", err, "chirp_id", chirpUUID)
+		return
+	}
+	if err != nil || !canView(dbChirp, uuid.NullUUID{UUID: userID, Valid: true}) {
+		respondWithError(w, 404, errCodeNotFound, "chirp not found")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	rows, err := cfg.db.CreateChirpReport(ctx, database.CreateChirpReportParams{
+		ChirpID:    chirpUUID,
+		ReporterID: userID,
+		Reason:     reason,
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error reporting chirp", err, "chirp_id", chirpUUID, "user_id", userID)
+		return
+	}
+
+	if rows == 0 { // ON CONFLICT DO NOTHING: this user has already reported it
+		w.WriteHeader(200)
+		return
+	}
+	slog.Info("chirp reported", "chirp_id", chirpUUID, "user_id", userID, "request_id", requestIDFromContext(req.Context()))
+	w.WriteHeader(201)
+}
+
+// GET /admin/reports - the chirps with reports against them, most reported first
+func (cfg *apiConfig) middlewareMetricsGetReportedChirps(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	rows, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) ([]database.GetReportedChirpsRow, error) {
+		return cfg.db.GetReportedChirps(ctx, reportedChirpsLimit)
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting reported chirps", err)
+		return
+	}
+
+	reported := []ReportedChirp{} // send [] rather than null when there aren't any
+	for _, row := range rows {
+		reported = append(reported, ReportedChirp{
+			Chirp:          chirpFromDB(row.Chirp),
+			ReportCount:    row.ReportCount,
+			LastReportedAt: newTimestamp(row.LastReportedAt),
+		})
+	}
+
+	jsonWriter(w, 200, reported)
+}
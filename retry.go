@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// retryPolicy says how hard withRetry tries: up to maxRetries more attempts after the first,
+// waiting baseDelay before the first retry and twice as long before each one after that.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+const (
+	defaultDBMaxRetries = 2
+	defaultDBRetryDelay = 50 * time.Millisecond
+)
+
+// withRetry runs op, and runs it again (with exponential backoff) if it fails with a transient error
+// (see isRetriable). It gives up early rather than sleep past ctx's deadline, so wrap it in dbContext
+// and the timeout covers every attempt, not each one.
+// Only use it for reads - retrying a write that actually went through could apply it twice.
+func withRetry[T any](ctx context.Context, policy retryPolicy, op func(ctx context.Context) (T, error)) (T, error) {
+	delay := policy.baseDelay
+	for attempt := 0; ; attempt++ {
+		result, err := op(ctx)
+		if err == nil || attempt >= policy.maxRetries || !isRetriable(err) {
+			return result, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, err // no time left for another go
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// isRetriable reports whether err is the kind of database error that's worth trying again:
+// a dropped connection (e.g. during a failover) or postgres giving up on a transaction because of
+// a conflict with another one. Anything else (no rows, bad input, timeouts...) won't get better by retrying.
+func isRetriable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || // connection_exception and friends
+			code == "40001" || // serialization_failure
+			code == "40P01" || // deadlock_detected
+			code == "57P01" // admin_shutdown (the server we were talking to is going away)
+	}
+	return false
+}
+
+// dbBusyRetryAfter is how long, in seconds, we tell clients to wait when the connection pool is full:
+// long enough for the queries holding it to finish, short enough that nobody gives up.
+const dbBusyRetryAfter = "1"
+
+// isPoolExhausted reports whether err means a database call never got a connection to run on: it ran out
+// of time waiting while all of the pool's connections (capped by DB_MAX_OPEN_CONNS) were in use. That's
+// about load rather than the query, so it's worth retrying shortly. See poolWaitDB for how it's told apart
+// from a query that was just slow.
+func isPoolExhausted(err error) bool {
+	return errors.Is(err, errPoolWait)
+}
+
+// errPoolWait marks the error of a database call whose context ran out while it was still waiting for a
+// connection, rather than while its query ran. It wraps the context's error, so it's a timeout too.
+var errPoolWait = errors.New("timed out waiting for a database connection")
+
+// poolWaitDB is the connection pool as the queries (and withTx) see it: it adds errPoolWait to the error of
+// any call that timed out waiting for a connection. database/sql gives back the same context error whether
+// the wait or the query ran out of time, so it goes by the pool's wait statistics around the call: the call
+// timed out, a wait started during it, and waiting took up most of its time. Under heavy load another
+// request's wait can be taken for this one's, but then the pool is busy anyway.
+type poolWaitDB struct {
+	*sql.DB
+}
+
+func (p poolWaitDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := p.watch(ctx, func() (err error) {
+		result, err = p.DB.ExecContext(ctx, query, args...)
+		return err
+	})
+	return result, err
+}
+
+func (p poolWaitDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	var stmt *sql.Stmt
+	err := p.watch(ctx, func() (err error) {
+		stmt, err = p.DB.PrepareContext(ctx, query)
+		return err
+	})
+	return stmt, err
+}
+
+func (p poolWaitDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := p.watch(ctx, func() (err error) {
+		rows, err = p.DB.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, err
+}
+
+func (p poolWaitDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	var row *sql.Row
+	err := p.watch(ctx, func() error {
+		row = p.DB.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	})
+	if errors.Is(err, errPoolWait) {
+		// only database/sql can make a *sql.Row, but given a context that's already done it gives one back
+		// straight away, without running anything, holding that context's Err()
+		return p.DB.QueryRowContext(doneContext{Context: ctx, err: err}, query, args...)
+	}
+	return row
+}
+
+func (p poolWaitDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	var tx *sql.Tx
+	err := p.watch(ctx, func() (err error) {
+		tx, err = p.DB.BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+// watch runs call, and adds errPoolWait to its error if it timed out waiting for a connection
+func (p poolWaitDB) watch(ctx context.Context, call func() error) error {
+	before, start := p.Stats(), time.Now()
+	err := call()
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	after := p.Stats()
+	if after.WaitCount > before.WaitCount && after.WaitDuration-before.WaitDuration >= time.Since(start)/2 {
+		return fmt.Errorf("%w: %w", errPoolWait, err)
+	}
+	return err
+}
+
+// doneContext is ctx, but already done with err
+type doneContext struct {
+	context.Context
+	err error
+}
+
+var closedDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
+
+func (c doneContext) Done() <-chan struct{} { return closedDone }
+func (c doneContext) Err() error            { return c.err }
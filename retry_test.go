@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestWithRetry(t *testing.T) {
+	policy := retryPolicy{maxRetries: 2, baseDelay: time.Millisecond}
+	transient := &pq.Error{Code: "40001"} // serialization_failure
+
+	cases := []struct {
+		name      string
+		errs      []error // returned by successive attempts; nil once they run out
+		wantCalls int
+		wantErr   bool
+	}{
+		{"fails twice then succeeds", []error{transient, driver.ErrBadConn}, 3, false},
+		{"keeps failing", []error{transient, transient, transient, transient}, 3, true},
+		{"not retriable", []error{sql.ErrNoRows}, 1, true},
+		{"unique violation isn't retried", []error{&pq.Error{Code: "23505"}}, 1, true},
+	}
+
+	for _, c := range cases {
+		calls := 0
+		got, err := withRetry(context.Background(), policy, func(ctx context.Context) (int, error) {
+			calls++
+			if calls <= len(c.errs) {
+				return 0, c.errs[calls-1]
+			}
+			return 42, nil
+		})
+		if calls != c.wantCalls {
+			t.Errorf("%s: expected %v calls, got: %v", c.name, c.wantCalls, calls)
+		}
+		if c.wantErr != (err != nil) {
+			t.Errorf("%s: expected error: %v, got: %v", c.name, c.wantErr, err)
+		}
+		if !c.wantErr && got != 42 {
+			t.Errorf("%s: expected result: 42, got: %v", c.name, got)
+		}
+	}
+}
+
+func TestWithRetryRespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	policy := retryPolicy{maxRetries: 5, baseDelay: time.Second} // first backoff alone is past the deadline
+
+	calls := 0
+	start := time.Now()
+	_, err := withRetry(ctx, policy, func(ctx context.Context) (int, error) {
+		calls++
+		return 0, driver.ErrBadConn
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected one failed attempt, got %v calls and error: %v", calls, err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected to give up straight away, took: %v", time.Since(start))
+	}
+}
+
+func TestIsPoolExhausted(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("%w: %w", errPoolWait, context.DeadlineExceeded), true},
+		{context.DeadlineExceeded, false}, // a slow query, not a full pool
+		{sql.ErrConnDone, false},          // a connection that was closed, not one we couldn't get
+		{sql.ErrNoRows, false},
+	}
+	for _, c := range cases {
+		if got := isPoolExhausted(c.err); got != c.want {
+			t.Errorf("%v: expected: %v, got: %v", c.err, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+)
+
+// sample data for local testing - passwords are deliberately known, so NEVER seed a real database!
+var seedUsers = []struct {
+	email    string
+	password string
+	chirps   []string
+}{
+	{"walt@breakingbad.com", "password123", []string{
+		"I'm the one who knocks!",
+		"Say my name.",
+	}},
+	{"saul@bettercall.com", "password123", []string{
+		"S'all good, man.",
+	}},
+	{"jesse@pinkman.com", "password123", []string{
+		"Yeah, science!",
+		"This is my own private domicile and I will not be harassed.",
+	}},
+}
+
+// seedDatabase fills the database with seedUsers and their chirps, and prints an access token for each
+// user so the API can be poked at straight away. Users that already exist are reused rather than recreated,
+// so it's safe to run more than once (though their chirps will be added again).
+func (cfg *apiConfig) seedDatabase(ctx context.Context) error {
+	for _, seed := range seedUsers {
+		user, err := cfg.db.GetUserByEmail(ctx, seed.email)
+		if errors.Is(err, sql.ErrNoRows) {
+			hashedPassword, err := cfg.passwordAlgorithm.Hash(seed.password)
+			if err != nil {
+				return fmt.Errorf("error hashing password for %s: %w", seed.email, err)
+			}
+			user, err = cfg.db.CreateUser(ctx, database.CreateUserParams{
+				Email:          seed.email,
+				HashedPassword: hashedPassword,
+			})
+			if err != nil {
+				return fmt.Errorf("error creating user %s: %w", seed.email, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("error looking up user %s: %w", seed.email, err)
+		}
+
+		for _, body := range seed.chirps {
+			_, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{
+				Body:       body,
+				UserID:     user.ID,
+				Visibility: database.ChirpVisibilityPublic,
+			})
+			if err != nil {
+				return fmt.Errorf("error creating chirp for %s: %w", seed.email, err)
+			}
+		}
+
+		token, err := cfg.jwtKeys.MakeJWT(user.ID, cfg.accessTokenTTL, cfg.audience)
+		if err != nil {
+			return fmt.Errorf("error making token for %s: %w", seed.email, err)
+		}
+
+		fmt.Printf("seeded %s (password: %s, %d chirps)\n  id:    %s\n  token: %s\n",
+			seed.email, seed.password, len(seed.chirps), user.ID, token)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second // how long in-flight requests get to finish once we're told to stop
+
+// tlsFiles is the certificate and key to serve HTTPS with (TLS_CERT, TLS_KEY); the zero value means plain HTTP.
+type tlsFiles struct {
+	certFile string
+	keyFile  string
+}
+
+func (t tlsFiles) enabled() bool {
+	return t.certFile != ""
+}
+
+// parseTLSFiles wants both or neither, so a half-configured deployment doesn't quietly fall back to plain HTTP.
+func parseTLSFiles(certFile, keyFile string) (tlsFiles, error) {
+	if (certFile == "") != (keyFile == "") {
+		return tlsFiles{}, errors.New("TLS_CERT and TLS_KEY must be set together")
+	}
+	return tlsFiles{certFile: certFile, keyFile: keyFile}, nil
+}
+
+// serve runs srv on ln until ctx is cancelled (SIGINT/SIGTERM in main), then shuts down gracefully:
+// it stops accepting connections and gives in-flight requests up to shutdownTimeout to finish.
+// With TLS, net/http negotiates HTTP/2 on its own via ALPN.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, tls tlsFiles) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		if tls.enabled() {
+			serveErr <- srv.ServeTLS(ln, tls.certFile, tls.keyFile)
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err // never started (bad cert, say) or died; ErrServerClosed can't happen before Shutdown
+	case <-ctx.Done():
+	}
+
+	slog.Info("server shutting down", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
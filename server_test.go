@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTLSFiles(t *testing.T) {
+	files, err := parseTLSFiles("", "")
+	if err != nil || files.enabled() {
+		t.Errorf("expected plain HTTP with neither set, got: %v and %v", files, err)
+	}
+
+	files, err = parseTLSFiles("cert.pem", "key.pem")
+	if err != nil || !files.enabled() {
+		t.Errorf("expected TLS with both set, got: %v and %v", files, err)
+	}
+
+	if _, err := parseTLSFiles("cert.pem", ""); err == nil {
+		t.Errorf("expected error with only TLS_CERT set, got none")
+	}
+	if _, err := parseTLSFiles("", "key.pem"); err == nil {
+		t.Errorf("expected error with only TLS_KEY set, got none")
+	}
+}
+
+// startServer runs serve on a free port and returns its address, the function that stops it, and serve's result.
+func startServer(t *testing.T, handler http.Handler, files tlsFiles) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, &http.Server{Handler: handler}, ln, files)
+	}()
+	return ln.Addr().String(), cancel, done
+}
+
+func waitForShutdown(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected clean shutdown, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("server didn't shut down")
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(200)
+	})
+	addr, stop, done := startServer(t, handler, tlsFiles{})
+
+	// a request that's still running when shutdown starts gets to finish
+	respErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != 200 {
+				t.Errorf("expected status: 200, got: %v", resp.StatusCode)
+			}
+		}
+		respErr <- err
+	}()
+	<-started
+	stop()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected serve to wait for the in-flight request, returned: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-respErr; err != nil {
+		t.Errorf("expected in-flight request to finish, got: %v", err)
+	}
+	waitForShutdown(t, done)
+
+	// and nothing new gets in afterwards
+	if _, err := http.Get("http://" + addr + "/"); err == nil {
+		t.Errorf("expected connection refused after shutdown")
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	files, pool := writeTestCert(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	})
+	addr, stop, done := startServer(t, handler, files)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatalf("error making HTTPS request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected status: 200, got: %v", resp.StatusCode)
+	}
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got: %v", resp.Proto)
+	}
+
+	stop()
+	waitForShutdown(t, done)
+}
+
+func TestServeBadCert(t *testing.T) {
+	dir := t.TempDir()
+	files := tlsFiles{certFile: filepath.Join(dir, "missing.pem"), keyFile: filepath.Join(dir, "missing-key.pem")}
+	_, _, done := startServer(t, http.NotFoundHandler(), files)
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("expected error for missing cert, got none")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected serve to fail straight away with a missing cert")
+	}
+}
+
+// writeTestCert makes a self-signed cert for 127.0.0.1, and a pool that trusts it.
+func writeTestCert(t *testing.T) (tlsFiles, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "chirpy test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating cert: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("error marshalling key: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := tlsFiles{certFile: filepath.Join(dir, "cert.pem"), keyFile: filepath.Join(dir, "key.pem")}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(files.certFile, certPEM, 0o600); err != nil {
+		t.Fatalf("error writing cert: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(files.keyFile, keyPEM, 0o600); err != nil {
+		t.Fatalf("error writing key: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	return files, pool
+}
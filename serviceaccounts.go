@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// scopes a service account can be granted, and so ask for at POST /api/token
+const (
+	scopeIntrospect = "introspect" // POST /api/introspect, in place of INTROSPECTION_API_KEY
+	scopeMetrics    = "metrics"    // GET /metrics, in place of INTROSPECTION_API_KEY
+)
+
+var serviceScopes = []string{scopeIntrospect, scopeMetrics}
+
+// ServiceAccount is a service account as the admin endpoints show it. ClientSecret is only ever
+// filled in when it's created: we keep a hash, so there's no getting it back later.
+type ServiceAccount struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	CreatedAt    Timestamp `json:"created_at"`
+	Name         string    `json:"name"`
+	Scopes       []string  `json:"scopes"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// TokenRequest is an OAuth 2.0 client credentials grant (RFC 6749 section 4.4). It can come as JSON or as
+// a form, and the credentials can be in HTTP Basic auth instead, so off-the-shelf OAuth clients work too.
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Scope        string `json:"scope"` // space-separated; empty means everything the account was granted
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` // seconds
+	Scope       string `json:"scope,omitempty"`
+}
+
+// POST /admin/service-accounts - creates a service account, answering with the only copy of its secret
+func (cfg *apiConfig) middlewareMetricsCreateServiceAccount(w http.ResponseWriter, req *http.Request) {
+	params := CreateServiceAccountRequest{}
+	if !decodeJSONBody(w, req, maxRequestSize, &params) {
+		return
+	}
+
+	fields := fieldErrors{}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		fields.add("name", "is required")
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(serviceScopes, scope) {
+			fields.add("scopes", fmt.Sprintf("unknown scope %q (want one of: %s)", scope, strings.Join(serviceScopes, ", ")))
+		}
+	}
+	if len(fields) > 0 {
+		respondWithFieldErrors(w, fields)
+		return
+	}
+
+	secret, err := auth.MakeToken()
+	if err != nil {
+		logRequestError(req, "error making client secret", err)
+		respondWithError(w, 500, errCodeInternal, "error creating service account")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	account, err := cfg.db.CreateServiceAccount(ctx, database.CreateServiceAccountParams{
+		Name:       params.Name,
+		SecretHash: auth.HashToken(secret),
+		Scopes:     slices.Compact(slices.Sorted(slices.Values(params.Scopes))),
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error creating service account", err)
+		return
+	}
+
+	adminID, _ := userIDFromContext(req.Context())
+	slog.Info("service account created", "client_id", account.ID, "admin_id", adminID, "request_id", requestIDFromContext(req.Context()))
+	jsonWriter(w, 201, ServiceAccount{
+		ClientID:     account.ID,
+		CreatedAt:    newTimestamp(account.CreatedAt),
+		Name:         account.Name,
+		Scopes:       account.Scopes,
+		ClientSecret: secret,
+	})
+}
+
+// DELETE /admin/service-accounts/{clientID} - deletes a service account. Tokens already issued to it
+// stop working straight away, since validateServiceToken looks the account up every time.
+func (cfg *apiConfig) middlewareMetricsDeleteServiceAccount(w http.ResponseWriter, req *http.Request) {
+	clientID, err := uuid.Parse(req.PathValue("clientID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid client id")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	deleted, err := cfg.db.DeleteServiceAccount(ctx, clientID)
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error deleting service account", err, "client_id", clientID)
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, errCodeNotFound, "service account not found")
+		return
+	}
+
+	adminID, _ := userIDFromContext(req.Context())
+	slog.Info("service account deleted", "client_id", clientID, "admin_id", adminID, "request_id", requestIDFromContext(req.Context()))
+	w.WriteHeader(204)
+}
+
+// POST /api/token - trades a service account's client id and secret for an access token carrying the
+// scopes asked for (all of the account's, if none are). Service tokens never stand in for a user:
+// middlewareAuth turns them away, and only routes behind middlewareServiceAuth accept them.
+func (cfg *apiConfig) middlewareMetricsIssueServiceToken(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxRequestSize)
+	params, err := decodeTokenRequest(req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithBodyTooLarge(w, tooLarge.Limit)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidJSON, err.Error())
+		return
+	}
+	if params.GrantType != "client_credentials" {
+		respondWithError(w, 400, errCodeBadRequest, `grant_type must be "client_credentials"`)
+		return
+	}
+
+	clientID, err := uuid.Parse(params.ClientID)
+	if err != nil {
+		respondWithError(w, 401, errCodeUnauthorized, "invalid client credentials")
+		return
+	}
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	account, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.ServiceAccount, error) {
+		return cfg.db.GetServiceAccount(ctx, clientID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 401, errCodeUnauthorized, "invalid client credentials")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting service account", err, "client_id", clientID)
+		return
+	}
+	// constant time, like the API key check
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(params.ClientSecret)), []byte(account.SecretHash)) != 1 {
+		respondWithError(w, 401, errCodeUnauthorized, "invalid client credentials")
+		return
+	}
+
+	scopes := account.Scopes
+	if params.Scope != "" {
+		scopes = strings.Fields(params.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(account.Scopes, scope) {
+				respondWithError(w, 403, errCodeForbidden, fmt.Sprintf("scope %q isn't granted to this client", scope))
+				return
+			}
+		}
+	}
+
+	token, err := cfg.jwtKeys.MakeServiceJWT(account.ID, scopes, cfg.accessTokenTTL, cfg.audience)
+	if err != nil {
+		logRequestError(req, "error making service token", err, "client_id", account.ID)
+		respondWithError(w, 500, errCodeInternal, "error issuing token")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store") // RFC 6749 section 5.1: never cache a token response
+	jsonWriter(w, 200, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(cfg.accessTokenTTL / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// decodeTokenRequest reads a TokenRequest from a form or JSON body, taking the client credentials from
+// HTTP Basic auth if they aren't in the body. A body over its MaxBytesReader limit comes back as the
+// *http.MaxBytesError; any other error's message is fit to send to the client.
+func decodeTokenRequest(req *http.Request) (TokenRequest, error) {
+	var params TokenRequest
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		if err := req.ParseForm(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return TokenRequest{}, tooLarge
+			}
+			return TokenRequest{}, errors.New("error decoding form")
+		}
+		params = TokenRequest{
+			GrantType:    req.PostForm.Get("grant_type"),
+			ClientID:     req.PostForm.Get("client_id"),
+			ClientSecret: req.PostForm.Get("client_secret"),
+			Scope:        req.PostForm.Get("scope"),
+		}
+	} else {
+		err := json.NewDecoder(req.Body).Decode(&params)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return TokenRequest{}, tooLarge
+		}
+		if isEmptyBody(err) {
+			return TokenRequest{}, errors.New("request body is empty")
+		}
+		if err != nil {
+			return TokenRequest{}, errors.New("Error decoding params")
+		}
+	}
+
+	if params.ClientID == "" {
+		params.ClientID, params.ClientSecret, _ = req.BasicAuth()
+	}
+	return params, nil
+}
+
+// validateServiceToken checks a service token (see auth.KeySet.ValidateServiceJWT) and that its service
+// account still exists, so deleting one locks it out at once rather than when its tokens expire.
+func (cfg *apiConfig) validateServiceToken(ctx context.Context, token string) (auth.ServiceTokenInfo, error) {
+	info, err := cfg.jwtKeys.ValidateServiceJWT(token, cfg.audience)
+	if err != nil {
+		return auth.ServiceTokenInfo{}, err
+	}
+
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	_, err = withRetry(dbCtx, cfg.dbRetry, func(ctx context.Context) (database.ServiceAccount, error) {
+		return cfg.db.GetServiceAccount(ctx, info.ClientID)
+	})
+	if err != nil {
+		return auth.ServiceTokenInfo{}, fmt.Errorf("error getting service account: %w", err)
+	}
+	return info, nil
+}
+
+// middlewareServiceAuth only lets through service tokens (from POST /api/token) granted scope. Missing or
+// invalid tokens, users' included, get 401; a valid one without the scope gets 403. The service account
+// is then available from serviceFromContext - there's no user ID, since no user is involved.
+func (cfg *apiConfig) middlewareServiceAuth(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+		info, err := cfg.validateServiceToken(r.Context(), token)
+		if err != nil {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+		if !info.HasScope(scope) {
+			respondWithError(w, 403, errCodeForbidden, fmt.Sprintf("token lacks the %q scope", scope))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), serviceKey, info)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// serviceFromContext returns the service token stored by middlewareServiceAuth or middlewareOptionalAuth.
+// ok is false if the request wasn't made with one.
+func serviceFromContext(ctx context.Context) (auth.ServiceTokenInfo, bool) {
+	info, ok := ctx.Value(serviceKey).(auth.ServiceTokenInfo)
+	return info, ok
+}
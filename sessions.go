@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gainax2k1/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var errSessionRevoked = errors.New("session revoked")
+
+// sessionDenylist remembers when each kicked user was revoked, so access tokens issued before then stop
+// working straight away instead of whenever they expire. JWTs can't be taken back once handed out, so
+// this is the only way to do it without a database lookup on every request.
+//
+// Entries only need to outlive the tokens they block: after the access token TTL, every token issued
+// before the revocation has expired anyway, so the entry is dropped. It lives in memory, so a restart
+// (or a second instance) forgets it - at worst a kicked user's old token works until it expires.
+// Tokens carry their issue time to the second, so one issued in the same second as the revocation is
+// blocked too, even if it came just after.
+type sessionDenylist struct {
+	mu        sync.Mutex
+	revokedAt map[uuid.UUID]time.Time
+	ttl       time.Duration
+}
+
+func newSessionDenylist(ttl time.Duration) *sessionDenylist {
+	return &sessionDenylist{revokedAt: make(map[uuid.UUID]time.Time), ttl: ttl}
+}
+
+// revoke blocks every access token userID was issued up to and including at
+func (d *sessionDenylist) revoke(userID uuid.UUID, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(at)
+	d.revokedAt[userID] = at
+}
+
+// isRevoked reports whether a token for userID issued at issuedAt has been revoked
+func (d *sessionDenylist) isRevoked(userID uuid.UUID, issuedAt time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	revokedAt, ok := d.revokedAt[userID]
+	if !ok {
+		return false
+	}
+	if time.Since(revokedAt) > d.ttl {
+		delete(d.revokedAt, userID)
+		return false
+	}
+	return !issuedAt.After(revokedAt.Truncate(time.Second))
+}
+
+// prune drops entries old enough that the tokens they block have all expired. Caller holds mu.
+func (d *sessionDenylist) prune(now time.Time) {
+	for userID, revokedAt := range d.revokedAt {
+		if now.Sub(revokedAt) > d.ttl {
+			delete(d.revokedAt, userID)
+		}
+	}
+}
+
+// validateAccessToken is ValidateJWT plus the denylist check; every route that takes an access token goes through it.
+func (cfg *apiConfig) validateAccessToken(token string) (auth.TokenInfo, error) {
+	info, err := cfg.jwtKeys.Introspect(token, cfg.audience)
+	if err != nil {
+		return auth.TokenInfo{}, err
+	}
+	if cfg.revokedSessions.isRevoked(info.UserID, info.IssuedAt) {
+		return auth.TokenInfo{}, errSessionRevoked
+	}
+	return info, nil
+}
+
+// POST /admin/users/{userID}/revoke - logs a user out everywhere: every access token they hold stops
+// working, though they can log in again (see sessionDenylist for the fine print).
+func (cfg *apiConfig) middlewareMetricsRevokeUserSessions(w http.ResponseWriter, req *http.Request) {
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, errCodeInvalidID, "invalid user id")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	_, err = withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (database.User, error) {
+		return cfg.db.GetUserByID(ctx, userUUID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, errCodeNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error getting user", err, "user_id", userUUID)
+		return
+	}
+
+	cfg.revokedSessions.revoke(userUUID, time.Now())
+
+	adminID, _ := userIDFromContext(req.Context())
+	slog.Warn("user sessions revoked",
+		"user_id", userUUID,
+		"admin_id", adminID,
+		"request_id", requestIDFromContext(req.Context()),
+	)
+	w.WriteHeader(204)
+}
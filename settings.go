@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gainax2k1/chirpy/internal/database"
+)
+
+// maxUserSettingsSize is the most a user's settings can take up, as sent. Preferences are small;
+// this only stops the table being used as free storage.
+const maxUserSettingsSize = 16 << 10
+
+// GET /api/me/settings - the JSON object the caller last saved with PUT, or {} if they never have
+func (cfg *apiConfig) middlewareMetricsGetSettings(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	settings, err := withRetry(ctx, cfg.dbRetry, func(ctx context.Context) (json.RawMessage, error) {
+		return cfg.db.GetUserSettings(ctx, userID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		settings = json.RawMessage("{}")
+	} else if err != nil {
+		cfg.respondWithDBError(w, req, "error getting settings", err, "user_id", userID)
+		return
+	}
+
+	jsonWriter(w, 200, settings)
+}
+
+// PUT /api/me/settings - replaces the caller's settings with the request body, which can be any JSON
+// object up to maxUserSettingsSize. The server never looks inside it: what goes in it is up to clients.
+func (cfg *apiConfig) middlewareMetricsPutSettings(w http.ResponseWriter, req *http.Request) {
+	userID, _ := userIDFromContext(req.Context()) // set by middlewareAuth
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxUserSettingsSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondWithError(w, 413, errCodeTooLarge, fmt.Sprintf("settings must be at most %d bytes", maxUserSettingsSize))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, errCodeBadRequest, "error reading request body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		respondWithError(w, 400, errCodeInvalidJSON, "request body is empty")
+		return
+	}
+	if !json.Valid(body) {
+		respondWithError(w, 400, errCodeInvalidJSON, "settings must be valid JSON")
+		return
+	}
+	if bytes.TrimSpace(body)[0] != '{' {
+		respondWithError(w, 400, errCodeBadRequest, "settings must be a JSON object")
+		return
+	}
+
+	ctx, cancel := cfg.dbContext(req.Context())
+	defer cancel()
+	settings, err := cfg.db.UpsertUserSettings(ctx, database.UpsertUserSettingsParams{
+		UserID:   userID,
+		Settings: body,
+	})
+	if err != nil {
+		cfg.respondWithDBError(w, req, "error saving settings", err, "user_id", userID)
+		return
+	}
+
+	jsonWriter(w, 200, settings)
+}
@@ -0,0 +1,13 @@
+-- name: CreateChirpLink :exec
+INSERT INTO chirp_links (chirp_id, url)
+VALUES (
+    $1,
+    $2
+)
+ON CONFLICT (chirp_id, url) DO NOTHING;
+
+-- name: GetChirpLinks :many
+SELECT *
+    FROM chirp_links
+    WHERE chirp_id = $1
+    ORDER BY chirp_links.created_at ASC;
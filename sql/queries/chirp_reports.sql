@@ -0,0 +1,19 @@
+-- name: CreateChirpReport :execrows
+INSERT INTO chirp_reports (chirp_id, reporter_id, reason)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (chirp_id, reporter_id) DO NOTHING;
+
+-- name: GetReportedChirps :many
+SELECT
+    sqlc.embed(chirps),
+    COUNT(*) AS report_count,
+    MAX(chirp_reports.created_at)::timestamp AS last_reported_at
+    FROM chirp_reports
+    JOIN chirps ON chirps.id = chirp_reports.chirp_id
+    GROUP BY chirps.id
+    ORDER BY report_count DESC, last_reported_at DESC
+    LIMIT $1;
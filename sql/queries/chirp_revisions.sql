@@ -0,0 +1,12 @@
+-- name: CreateChirpRevision :exec
+INSERT INTO chirp_revisions (chirp_id, body)
+SELECT id, body
+    FROM chirps
+    WHERE id = $1
+    FOR UPDATE;
+
+-- name: GetChirpRevisions :many
+SELECT *
+    FROM chirp_revisions
+    WHERE chirp_id = $1
+    ORDER BY created_at ASC;
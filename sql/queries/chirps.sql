@@ -1,18 +1,197 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (body, user_id)
+INSERT INTO chirps (body, user_id, visibility, lang, status, media_url)
 VALUES (
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
 )
 
 RETURNING *;
 
 -- name: GetChirps :many
+-- oldest first. Every filter is optional (NULL skips it). body_pattern is an ILIKE pattern, so escape % and _ in what users type.
 SELECT *
     FROM chirps
-    ORDER BY chirps.created_at ASC;
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND (sqlc.narg(lang)::text IS NULL OR lang = sqlc.narg(lang)::text)
+        AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+        AND (sqlc.narg(body_pattern)::text IS NULL OR body ILIKE sqlc.narg(body_pattern)::text)
+    ORDER BY created_at ASC;
+
+-- name: GetChirpsNewestFirst :many
+-- GetChirps the other way round. Each order is its own query, rather than one ORDER BY CASE, so that
+-- both can read chirps_created_at_id_idx in order instead of sorting every chirp.
+SELECT *
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND (sqlc.narg(lang)::text IS NULL OR lang = sqlc.narg(lang)::text)
+        AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+        AND (sqlc.narg(body_pattern)::text IS NULL OR body ILIKE sqlc.narg(body_pattern)::text)
+    ORDER BY created_at DESC;
+
+-- name: GetChirpsAfterCursor :many
+-- one page at a time, oldest first: everything strictly after the (created_at, id) cursor, or from the very
+-- start when there's no cursor. id breaks ties between chirps created at the same moment. Filters work like GetChirps'.
+SELECT *
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND (sqlc.narg(lang)::text IS NULL OR lang = sqlc.narg(lang)::text)
+        AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+        AND (sqlc.narg(body_pattern)::text IS NULL OR body ILIKE sqlc.narg(body_pattern)::text)
+        AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+            OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+    ORDER BY created_at ASC, id ASC
+    LIMIT sqlc.arg(page_size);
+
+-- name: GetChirpsBeforeCursor :many
+-- GetChirpsAfterCursor newest first: everything strictly before the cursor.
+SELECT *
+    FROM chirps
+    WHERE status = 'published'
+        AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND (sqlc.narg(lang)::text IS NULL OR lang = sqlc.narg(lang)::text)
+        AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+        AND (sqlc.narg(body_pattern)::text IS NULL OR body ILIKE sqlc.narg(body_pattern)::text)
+        AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+            OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+    ORDER BY created_at DESC, id DESC
+    LIMIT sqlc.arg(page_size);
+
+-- name: GetRandomChirps :many
+-- public chirps only (it's for discovering people), optionally leaving out one user's own.
+-- ORDER BY random() sorts the whole table, which is fine at our size; revisit with TABLESAMPLE if it isn't.
+SELECT *
+    FROM chirps
+    WHERE status = 'published' AND visibility = 'public'
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+        AND (sqlc.narg(exclude_user_id)::uuid IS NULL OR user_id <> sqlc.narg(exclude_user_id)::uuid)
+    ORDER BY random()
+    LIMIT sqlc.arg(count);
 
 -- name: GetChirpByChirpUUID :one
 SELECT *
     FROM chirps
-    WHERE ID = $1;
\ No newline at end of file
+    WHERE ID = $1;
+
+-- name: GetChirpForUpdate :one
+-- locks the row until the transaction ends, so checks made on it still hold when it's updated
+SELECT *
+    FROM chirps
+    WHERE id = $1
+    FOR UPDATE;
+
+-- name: CountChirps :one
+SELECT COUNT(*)
+    FROM chirps;
+
+-- name: GetNewestChirpTimestamp :one
+-- the last time GET /api/chirps could have changed: an edit, or a chirp leaving or joining it (see TouchChirpList)
+SELECT GREATEST(
+        (SELECT MAX(updated_at) FROM chirps),
+        (SELECT changed_at FROM chirp_list_changes)
+    )::timestamp AS newest;
+
+-- name: TouchChirpList :exec
+-- for changes to the list that don't touch a chirp's updated_at: deletes, and accounts being (de|re)activated.
+-- Run it in the same transaction, so no one can see the change with the old Last-Modified.
+UPDATE chirp_list_changes
+    SET changed_at = NOW();
+
+-- name: CountVisibleChirps :one
+SELECT COUNT(*)
+    FROM chirps
+    WHERE status = 'published' AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL);
+
+
+-- name: UpdateChirp :one
+-- a NULL body or visibility keeps the current one; media_url is only touched when set_media_url is true
+UPDATE chirps
+    SET body = COALESCE(sqlc.narg(body), body),
+        visibility = COALESCE(sqlc.narg(visibility), visibility),
+        media_url = CASE WHEN sqlc.arg(set_media_url)::bool THEN sqlc.narg(media_url) ELSE media_url END,
+        updated_at = NOW()
+    WHERE id = sqlc.arg(id)
+RETURNING *;
+
+
+-- name: PublishChirp :one
+-- created_at moves to publish time, so a draft written last week doesn't appear a week down the timeline.
+-- No row if it's already published.
+UPDATE chirps
+    SET status = 'published',
+        created_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1 AND status = 'draft'
+RETURNING *;
+
+
+-- name: DeleteChirp :exec
+DELETE FROM chirps
+    WHERE id = $1;
+
+
+-- name: DeleteChirpsByUser :many
+DELETE FROM chirps
+    WHERE user_id = $1
+RETURNING id;
+
+
+-- name: UserChirpStats :one
+-- what anyone can see of a user's chirps: public and published, like GET /api/chirps shows a logged-out visitor
+SELECT
+    COUNT(*) AS total_chirps,
+    COALESCE(AVG(LENGTH(body)), 0)::float8 AS average_length,
+    MAX(created_at)::timestamp AS latest_chirp_at
+    FROM chirps
+    WHERE user_id = $1 AND status = 'published' AND visibility = 'public';
+
+
+-- name: GetChirpsByIDs :many
+SELECT *
+    FROM chirps
+    WHERE id = ANY(sqlc.arg(ids)::uuid[])
+        AND status = 'published'
+        AND (visibility = 'public' OR user_id = sqlc.narg(viewer_id))
+        AND user_id NOT IN (SELECT id FROM users WHERE deactivated_at IS NOT NULL)
+    ORDER BY chirps.created_at ASC;
+
+
+-- name: GetChirpsAfterID :many
+SELECT *
+    FROM chirps
+    WHERE id > $1
+    ORDER BY id ASC
+    LIMIT $2;
+
+
+-- name: ReplaceChirpBody :execrows
+UPDATE chirps
+    SET body = sqlc.arg(new_body), updated_at = NOW()
+    WHERE id = sqlc.arg(id) AND body = sqlc.arg(old_body);
+
+
+-- name: GetRecentIdenticalChirp :one
+-- the newest chirp the user already posted with this body (as stored, so after censoring), visibility,
+-- status, language and media since the given time. Finds double-posts; no row means it isn't one.
+SELECT *
+    FROM chirps
+    WHERE user_id = sqlc.arg(user_id)
+        AND body = sqlc.arg(body)
+        AND visibility = sqlc.arg(visibility)
+        AND status = sqlc.arg(status)
+        AND lang IS NOT DISTINCT FROM sqlc.narg(lang)
+        AND media_url IS NOT DISTINCT FROM sqlc.narg(media_url)
+        AND created_at >= sqlc.arg(since)
+    ORDER BY created_at DESC
+    LIMIT 1;
@@ -0,0 +1,27 @@
+-- name: CreateEmailChange :exec
+INSERT INTO email_changes (user_id, new_email, token_hash, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+)
+ON CONFLICT (user_id) DO UPDATE
+    SET created_at = NOW(),
+        new_email = EXCLUDED.new_email,
+        token_hash = EXCLUDED.token_hash,
+        expires_at = EXCLUDED.expires_at;
+
+-- name: GetEmailChange :one
+SELECT *
+    FROM email_changes
+    WHERE user_id = $1;
+
+-- name: GetEmailChangeByToken :one
+SELECT *
+    FROM email_changes
+    WHERE token_hash = $1;
+
+-- name: DeleteEmailChange :exec
+DELETE FROM email_changes
+    WHERE user_id = $1;
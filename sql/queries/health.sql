@@ -0,0 +1,2 @@
+-- name: GetServerVersion :one
+SELECT version();
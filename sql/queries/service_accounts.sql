@@ -0,0 +1,17 @@
+-- name: CreateServiceAccount :one
+INSERT INTO service_accounts (name, secret_hash, scopes)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetServiceAccount :one
+SELECT *
+    FROM service_accounts
+    WHERE id = $1;
+
+-- name: DeleteServiceAccount :execrows
+DELETE FROM service_accounts
+    WHERE id = $1;
@@ -17,3 +17,71 @@ SELECT *
     WHERE email = $1;
 
 
+
+-- name: EmailExists :one
+SELECT EXISTS (
+    SELECT 1 FROM users WHERE email = $1
+);
+
+-- name: CountUsers :one
+SELECT COUNT(*)
+    FROM users;
+
+-- name: GetUserByID :one
+SELECT *
+    FROM users
+    WHERE id = $1;
+
+
+-- name: UpdateUser :one
+UPDATE users
+    SET email = COALESCE(sqlc.narg(email), email),
+        hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+        updated_at = NOW()
+    WHERE id = sqlc.arg(id)
+RETURNING *;
+
+
+-- name: SetPinnedChirp :one
+UPDATE users
+    SET pinned_chirp_id = sqlc.narg(pinned_chirp_id),
+        updated_at = NOW()
+    WHERE id = sqlc.arg(id)
+RETURNING *;
+
+
+-- name: DeactivateUser :execrows
+-- only touches an active account, so deactivating twice doesn't push back the purge.
+UPDATE users
+    SET deactivated_at = NOW(),
+        updated_at = NOW()
+    WHERE id = $1 AND deactivated_at IS NULL;
+
+
+-- name: ReactivateUser :exec
+UPDATE users
+    SET deactivated_at = NULL,
+        updated_at = NOW()
+    WHERE id = $1;
+
+
+-- name: PromoteAdmin :execrows
+-- how the first admin gets made (ADMIN_EMAIL, see promoteAdmin): nothing in the API can set is_admin.
+UPDATE users
+    SET is_admin = TRUE,
+        updated_at = NOW()
+    WHERE email = $1 AND NOT is_admin;
+
+
+-- name: PurgeDeactivatedUsers :execrows
+-- for good: their chirps and everything else of theirs go too (ON DELETE CASCADE).
+DELETE FROM users
+    WHERE deactivated_at < sqlc.arg(deactivated_before)::timestamp;
+
+
+-- name: TouchUserLastSeen :exec
+-- at most once a minute per user, even with several instances each keeping their own lastSeenTracker.
+-- updated_at is left alone: being seen isn't an edit.
+UPDATE users
+    SET last_seen_at = NOW()
+    WHERE id = $1 AND (last_seen_at IS NULL OR last_seen_at < NOW() - INTERVAL '1 minute');
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE chirp_links(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    chirp_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    UNIQUE (chirp_id, url)
+);
+
+-- +goose Down
+DROP TABLE chirp_links;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- GetChirps sorts every chirp by created_at, and per-author queries (like UserChirpStats)
+-- filter on user_id - without these, both are full table scans.
+CREATE INDEX chirps_created_at_idx ON chirps (created_at);
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+
+-- +goose Down
+DROP INDEX chirps_user_id_created_at_idx;
+DROP INDEX chirps_created_at_idx;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- 'followers' is reserved for when there's a follows feature; until then the API only accepts public and private
+CREATE TYPE chirp_visibility AS ENUM ('public', 'private', 'followers');
+ALTER TABLE chirps ADD COLUMN visibility chirp_visibility NOT NULL DEFAULT 'public';
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN visibility;
+DROP TYPE chirp_visibility;
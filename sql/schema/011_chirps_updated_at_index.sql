@@ -0,0 +1,7 @@
+-- +goose Up
+-- GetNewestChirpTimestamp runs on every GET /api/chirps (for Last-Modified) - with this
+-- index MAX(updated_at) is a single index lookup instead of a full table scan.
+CREATE INDEX chirps_updated_at_idx ON chirps (updated_at);
+
+-- +goose Down
+DROP INDEX chirps_updated_at_idx;
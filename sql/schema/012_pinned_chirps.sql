@@ -0,0 +1,6 @@
+-- +goose Up
+-- one pinned chirp per user, shown at the top of their profile; deleting the chirp unpins it
+ALTER TABLE users ADD pinned_chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN pinned_chirp_id;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- ISO 639-1 code ("en", "es"...), or NULL when the author didn't say; the app checks it against an allowlist
+ALTER TABLE chirps ADD lang TEXT;
+CREATE INDEX chirps_lang_created_at_idx ON chirps (lang, created_at);
+
+-- +goose Down
+DROP INDEX chirps_lang_created_at_idx;
+ALTER TABLE chirps DROP COLUMN lang;
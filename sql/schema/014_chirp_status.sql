@@ -0,0 +1,8 @@
+-- +goose Up
+-- drafts are only ever shown to their author; everything already posted is published
+CREATE TYPE chirp_status AS ENUM ('draft', 'published');
+ALTER TABLE chirps ADD COLUMN status chirp_status NOT NULL DEFAULT 'published';
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN status;
+DROP TYPE chirp_status;
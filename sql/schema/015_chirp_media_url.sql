@@ -0,0 +1,6 @@
+-- +goose Up
+-- a link to an image or video hosted somewhere else; we don't store uploads ourselves
+ALTER TABLE chirps ADD COLUMN media_url TEXT;
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN media_url;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- whatever preferences clients want to keep server-side (theme, notification toggles...), as one JSON object.
+-- The server doesn't look inside it; see maxUserSettingsSize for the only limit.
+CREATE TABLE user_settings(
+    user_id UUID PRIMARY KEY,
+    settings JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_settings;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- set by DELETE /api/users: the account is hidden (and its chirps with it) but comes back if the user
+-- logs in again before it's purged. NULL for active accounts.
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
+CREATE INDEX users_deactivated_at_idx ON users (deactivated_at) WHERE deactivated_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_deactivated_at_idx;
+ALTER TABLE users DROP COLUMN deactivated_at;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- when the user last made an authenticated request, to the minute or so (see lastSeenInterval); NULL if never
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN last_seen_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- integrations that act as themselves rather than as a user: they trade their client id (the id) and secret
+-- for a token at POST /api/token. Only a hash of the secret is kept, like token_hash in email_changes.
+CREATE TABLE service_accounts(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- +goose Down
+DROP TABLE service_accounts;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- one row: when chirps last left or (re)joined GET /api/chirps without any chirp's updated_at moving -
+-- a delete, or an account being deactivated or reactivated. Last-Modified is the later of this and
+-- MAX(chirps.updated_at), so If-Modified-Since can't hide those.
+CREATE TABLE chirp_list_changes(
+    changed_at TIMESTAMP NOT NULL
+);
+INSERT INTO chirp_list_changes (changed_at) VALUES (NOW());
+
+-- +goose Down
+DROP TABLE chirp_list_changes;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- pages of GET /api/chirps go by (created_at, id), and a (created_at, id) > cursor condition can only be an
+-- index condition on an index with both columns. With created_at alone every page re-read the index from
+-- the start and threw away what came before the cursor. These replace the two indexes from 006; the
+-- per-author one still serves UserChirpStats, which only needs user_id and created_at.
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps (user_id, created_at, id);
+DROP INDEX chirps_created_at_idx;
+DROP INDEX chirps_user_id_created_at_idx;
+
+-- +goose Down
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+CREATE INDEX chirps_created_at_idx ON chirps (created_at);
+DROP INDEX chirps_user_id_created_at_id_idx;
+DROP INDEX chirps_created_at_id_idx;
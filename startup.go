@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const startupPingInterval = time.Second // how often warmUp retries a database that isn't up yet
+
+// warmUp is everything that has to happen before we take traffic. main() runs it after the server is
+// already listening, so GET /api/readyz can say "not yet" (rather than the connection being refused)
+// while it waits for postgres, applies migrations if asked to, and so on. cfg.ready is set once it's done.
+func (cfg *apiConfig) warmUp(ctx context.Context, migrate bool) error {
+	// a database that's still starting (say it came up with us in docker compose) is worth waiting for
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, cfg.dbTimeout)
+		err := cfg.sqlDB.PingContext(pingCtx) // also opens the pool's first connection, so no request has to
+		cancel()
+		if err == nil {
+			break
+		}
+		slog.Warn("database not reachable yet", "error", err, "retry_in", startupPingInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(startupPingInterval):
+		}
+	}
+
+	// Migrations are opt-in: set MIGRATE_ON_STARTUP=true to apply pending ones here.
+	// Leave it unset where migrations are run separately (e.g. by hand with the goose CLI).
+	if migrate {
+		if err := runMigrations(ctx, cfg.sqlDB); err != nil {
+			return fmt.Errorf("error running migrations: %w", err)
+		}
+	}
+
+	if err := cfg.promoteAdmin(ctx); err != nil {
+		return fmt.Errorf("error promoting ADMIN_EMAIL: %w", err)
+	}
+
+	cfg.ready.Store(true)
+	return nil
+}
+
+// promoteAdmin makes the ADMIN_EMAIL account an admin, which is the only way anyone becomes one. It's done
+// at startup rather than at signup because signing up doesn't prove you own the address: whoever got to
+// ADMIN_EMAIL first would be an admin. So the account has to exist first - until it does, we just say so.
+func (cfg *apiConfig) promoteAdmin(ctx context.Context) error {
+	if cfg.adminEmail == "" {
+		return nil
+	}
+	dbCtx, cancel := cfg.dbContext(ctx)
+	defer cancel()
+	promoted, err := cfg.db.PromoteAdmin(dbCtx, cfg.adminEmail)
+	if err != nil {
+		return err
+	}
+	if promoted > 0 {
+		slog.Info("promoted user to admin", "email", cfg.adminEmail)
+		return nil
+	}
+	exists, err := cfg.db.EmailExists(dbCtx, cfg.adminEmail)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		slog.Warn("ADMIN_EMAIL has no account yet: sign up with it and restart to make it an admin", "email", cfg.adminEmail)
+	}
+	return nil
+}
+
+// GET /api/readyz - whether to send this instance traffic: 503 until warmUp has finished, 200 after.
+// Unlike GET /api/healthz it never touches the database itself, so it's cheap to poll.
+func (cfg *apiConfig) readyz(w http.ResponseWriter, req *http.Request) {
+	if !cfg.ready.Load() {
+		respondWithError(w, 503, errCodeNotReady, "still starting up")
+		return
+	}
+	jsonWriter(w, 200, Health{Status: "ok"})
+}
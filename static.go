@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStaticMaxAge = time.Hour            // how long browsers may reuse a static file without asking (STATIC_MAX_AGE)
+	maxStaticMaxAge     = 365 * 24 * time.Hour // the most Cache-Control is meant to say (RFC 9111)
+)
+
+// middlewareStaticCache adds caching headers to a fileserver serving root. Everything gets an ETag made
+// from the file's modification time and size, which http.FileServer then uses to answer If-None-Match
+// with 304. Images, scripts and the like can be reused for maxAge without asking; HTML is "no-cache"
+// (always check first, which the ETag makes cheap), so a deploy shows up on the next page load even
+// though the assets it points at may take up to maxAge to.
+// It sits inside http.StripPrefix, so the request path is relative to root.
+func middlewareStaticCache(root http.FileSystem, maxAge time.Duration, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path
+		if name == "" || strings.HasSuffix(name, "/") {
+			name += "index.html" // what FileServer serves for a directory, if there is one
+		}
+
+		// http.FileSystem cleans the path, so nothing outside root can be looked at this way
+		if f, err := root.Open(name); err == nil {
+			info, err := f.Stat()
+			f.Close()
+			if err == nil && !info.IsDir() {
+				w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+				if path.Ext(name) == ".html" {
+					w.Header().Set("Cache-Control", "no-cache")
+				} else {
+					w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second)))
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
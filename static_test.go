@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareStaticCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>Chirpy</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "logo.png"), []byte("not really a png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler := http.StripPrefix("/app/", middlewareStaticCache(http.Dir(root), time.Hour, http.FileServer(http.Dir(root))))
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		path         string
+		cacheControl string
+	}{
+		{"/app/logo.png", "public, max-age=3600"},
+		{"/app/", "no-cache"}, // index.html
+		{"/app/index.html", "no-cache"},
+	}
+	for _, c := range cases {
+		rec := get(c.path, "")
+		etag := rec.Header().Get("ETag")
+		if got := rec.Header().Get("Cache-Control"); got != c.cacheControl {
+			t.Errorf("%s: expected Cache-Control %q, got: %q", c.path, c.cacheControl, got)
+		}
+		if etag == "" {
+			t.Errorf("%s: expected an ETag, got none", c.path)
+			continue
+		}
+		if rec.Code == 200 {
+			if again := get(c.path, etag); again.Code != 304 {
+				t.Errorf("%s: expected 304 for a matching If-None-Match, got: %v", c.path, again.Code)
+			}
+		}
+	}
+
+	// changing the file changes the ETag
+	before := get("/app/logo.png", "").Header().Get("ETag")
+	if err := os.WriteFile(filepath.Join(root, "logo.png"), []byte("a newer, bigger not-png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if after := get("/app/logo.png", before); after.Code != 200 || after.Header().Get("ETag") == before {
+		t.Errorf("changed file: expected 200 with a new ETag, got: %v %q", after.Code, after.Header().Get("ETag"))
+	}
+
+	// nothing to cache for a file that isn't there
+	if rec := get("/app/missing.js", ""); rec.Code != 404 || rec.Header().Get("Cache-Control") != "" {
+		t.Errorf("missing file: expected 404 without Cache-Control, got: %v %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+}
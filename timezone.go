@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+	_ "time/tzdata" // so ?tz= works even where the host has no zoneinfo (e.g. a scratch container)
+)
+
+var errUnknownTimezone = errors.New(`tz must be an IANA time zone, like "America/New_York"`)
+
+// parseTimezone reads the optional ?tz= that chirp endpoints take. nil means it wasn't given, and
+// timestamps stay in UTC. "Local" is refused: it's whatever zone the server happens to run in.
+func parseTimezone(query url.Values) (*time.Location, error) {
+	tz := query.Get("tz")
+	if tz == "" {
+		return nil, nil
+	}
+	if tz == "Local" {
+		return nil, errUnknownTimezone
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errUnknownTimezone
+	}
+	return loc, nil
+}
+
+// inTimezone is c with its timestamps shown in loc (same instants, just a different offset in the JSON).
+// A nil loc leaves them alone.
+func (c Chirp) inTimezone(loc *time.Location) Chirp {
+	if loc == nil {
+		return c
+	}
+	c.CreatedAt = Timestamp{c.CreatedAt.In(loc)}
+	c.UpdatedAt = Timestamp{c.UpdatedAt.In(loc)}
+	return c
+}
+
+// timestampFormat is RFC 3339 with exactly three fractional digits, always. time.Time's own JSON drops
+// trailing zeros and carries whatever precision Postgres gave us, so the same instant could come out
+// as ".12Z" in one response and ".120483Z" in another, which trips up clients comparing them.
+const timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Timestamp is a time.Time in a response. It marshals to timestampFormat, truncated to the millisecond.
+type Timestamp struct {
+	time.Time
+}
+
+// newTimestamp is t as a response Timestamp, in UTC (?tz= moves it elsewhere later, see inTimezone)
+func newTimestamp(t time.Time) Timestamp {
+	return Timestamp{t.UTC()}
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return fmt.Appendf(nil, "%q", t.Truncate(time.Millisecond).Format(timestampFormat)), nil
+}
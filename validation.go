@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const minPasswordLength = 8 // characters
+
+// how long we wait for the breach check before giving up and allowing the password
+const breachCheckTimeout = 3 * time.Second
+
+const breachedPasswordMessage = "has appeared in a data breach, please choose another"
+
+// fieldErrors collects what's wrong with a request body, keyed by JSON field name, so a form can
+// show each message next to the right input. Only the first problem with each field is kept.
+type fieldErrors map[string]string
+
+func (fe fieldErrors) add(field, msg string) {
+	if _, ok := fe[field]; !ok {
+		fe[field] = msg
+	}
+}
+
+// respondWithFieldErrors sends 422 with the usual errResponse plus a "fields" map.
+func respondWithFieldErrors(w http.ResponseWriter, fields fieldErrors) {
+	jsonWriter(w, http.StatusUnprocessableEntity, fieldErrorResponse(fields))
+}
+
+// fieldErrorResponse is what respondWithFieldErrors sends, for handlers that add to it first
+func fieldErrorResponse(fields fieldErrors) errResponse {
+	return errResponse{
+		Error:  "request has invalid fields",
+		Code:   errCodeValidation,
+		Fields: fields,
+	}
+}
+
+// isBreachedPassword asks cfg.breachChecker (if it's switched on) whether password is known from a breach.
+// It fails open: if the check can't be done, the password is allowed and we log a warning, so an
+// outage at HaveIBeenPwned doesn't stop anyone signing up or changing their password.
+func (cfg *apiConfig) isBreachedPassword(req *http.Request, password string) bool {
+	if cfg.breachChecker == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), breachCheckTimeout)
+	defer cancel()
+	breached, err := cfg.breachChecker.IsBreached(ctx, password)
+	if err != nil {
+		slog.Warn("password breach check failed, allowing password", "error", err, "request_id", requestIDFromContext(req.Context()))
+		return false
+	}
+	return breached
+}
+
+// isValidEmail is a bare address, the only form we store
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	// the second check rejects "Walt <walt@example.com>", which ParseAddress is happy with
+	return err == nil && addr.Address == email
+}
+
+// validateCreateUser checks POST /api/users before anything gets hashed or stored
+func validateCreateUser(params CreateUserRequest) fieldErrors {
+	fields := fieldErrors{}
+
+	if params.Email == "" {
+		fields.add("email", "is required")
+	} else if !isValidEmail(params.Email) {
+		fields.add("email", "must be a valid email")
+	}
+
+	if params.Password == "" {
+		fields.add("password", "is required")
+	} else if utf8.RuneCountInString(params.Password) < minPasswordLength {
+		fields.add("password", fmt.Sprintf("must be at least %d characters", minPasswordLength))
+	}
+
+	return fields
+}
+
+// sanitizeChirpBody strips control characters (NUL, escape sequences' ESC, DEL and the like) that only
+// break whatever renders the chirp later. Newlines and tabs stay: people use them. It runs on every new
+// or edited body before it's validated, so the length limit applies to what's actually stored.
+func sanitizeChirpBody(body string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, body)
+}
+
+// validateCreateChirp checks POST /api/chirps. The length limit is in bytes (like saveChirp's),
+// since that's what CHIRP_MAX_LENGTH has always meant.
+func (cfg *apiConfig) validateCreateChirp(params CreateChirp) fieldErrors {
+	fields := fieldErrors{}
+
+	if strings.TrimSpace(params.Body) == "" {
+		fields.add("body", "is required")
+	} else if len(params.Body) > cfg.maxChirpLength {
+		fields.add("body", fmt.Sprintf("must be at most %d characters", cfg.maxChirpLength))
+	}
+
+	if _, err := parseVisibility(params.Visibility); err != nil {
+		fields.add("visibility", `must be "public" or "private"`)
+	}
+
+	if _, err := parseLang(params.Lang); err != nil {
+		fields.add("lang", "must be a supported ISO 639-1 code, like \"en\"")
+	}
+
+	if _, err := parseChirpStatus(params.Status); err != nil {
+		fields.add("status", `must be "draft" or "published"`)
+	}
+
+	if _, err := parseMediaURL(params.MediaURL); err != nil {
+		fields.add("media_url", fmt.Sprintf("must be an http(s) URL of at most %d characters", maxMediaURLLength))
+	}
+
+	return fields
+}
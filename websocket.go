@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gainax2k1/chirpy/internal/auth"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket keep-alive timings: we ping every socketPingPeriod, and drop the client if we hear
+// nothing back (not even a pong) within socketPongWait. The ping period has to be the shorter one.
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = (socketPongWait * 9) / 10
+	socketMaxMessage = 4096 // bytes; plenty for a chirp plus its JSON wrapper
+)
+
+// message types sent over GET /api/ws
+const (
+	socketTypeChirp       = "chirp"        // server -> client: a new chirp (anyone's, including your own)
+	socketTypeError       = "error"        // server -> client: your last message didn't work
+	socketTypeCreateChirp = "create_chirp" // client -> server: post a chirp
+)
+
+// SocketMessage is every message on the WebSocket, in both directions; Type says which fields are set.
+type SocketMessage struct {
+	Type   string `json:"type"`
+	Chirp  *Chirp `json:"chirp,omitempty"`  // type "chirp"
+	Body   string `json:"body,omitempty"`   // type "create_chirp"
+	Error  string `json:"error,omitempty"`  // type "error"
+	Code   string `json:"code,omitempty"`   // type "error", same codes as errResponse
+	Max    int    `json:"max,omitempty"`    // type "error" with code chirp_too_long, as in errResponse
+	Length int    `json:"length,omitempty"` // same
+}
+
+// the zero Upgrader only accepts same-origin connections, which is what we want
+var socketUpgrader = websocket.Upgrader{}
+
+// GET /api/ws - streams new chirps live, and accepts {"type": "create_chirp", "body": "..."} to post one.
+// Browsers can't set headers on a WebSocket, so the access token can come as ?token=... (or the login
+// cookie) as well as the usual Authorization: Bearer header.
+func (cfg *apiConfig) middlewareMetricsChirpSocket(w http.ResponseWriter, req *http.Request) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		var err error
+		token, err = cfg.accessToken(req)
+		if err != nil {
+			respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+			return
+		}
+	}
+	info, err := cfg.validateAccessToken(token)
+	if err != nil {
+		respondWithError(w, 401, errCodeUnauthorized, "Unauthorized")
+		return
+	}
+	conn, err := socketUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return // Upgrade has already sent the client an error response
+	}
+	defer conn.Close()
+
+	chirps, unsubscribe := cfg.chirpHub.Subscribe()
+	defer unsubscribe()
+
+	// gorilla allows one reader and one writer at a time, so reads happen in their own goroutine
+	// and anything that needs sending back (errors) goes through replies to the writer below.
+	replies := make(chan SocketMessage, 1)
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	defer close(writerDone) // so the reader never blocks on replies after we've gone
+	go func() {
+		defer close(readerDone)
+		cfg.readChirpSocket(conn, req, info, replies, writerDone)
+	}()
+
+	ticker := time.NewTicker(socketPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		var msg SocketMessage
+		select {
+		case chirp, ok := <-chirps:
+			if !ok {
+				return
+			}
+			msg = SocketMessage{Type: socketTypeChirp, Chirp: &chirp}
+		case msg = <-replies:
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case <-readerDone: // client went away (or stopped answering pings)
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readChirpSocket handles incoming messages until the connection closes or goes quiet for too long.
+func (cfg *apiConfig) readChirpSocket(conn *websocket.Conn, req *http.Request, info auth.TokenInfo, replies chan<- SocketMessage, writerDone <-chan struct{}) {
+	conn.SetReadLimit(socketMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		var msg SocketMessage
+		err := conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Debug("websocket closed", "error", err, "user_id", info.UserID, "request_id", requestIDFromContext(req.Context()))
+			}
+			return
+		}
+
+		reply := cfg.handleSocketMessage(req, info, msg)
+		if reply == nil {
+			continue
+		}
+		select {
+		case replies <- *reply:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+// handleSocketMessage acts on one client message, returning an error message to send back if it failed.
+// A successfully created chirp isn't replied to directly - it comes back through chirpHub like everyone else's,
+// and neither is a duplicate, since the first copy already did.
+func (cfg *apiConfig) handleSocketMessage(req *http.Request, info auth.TokenInfo, msg SocketMessage) *SocketMessage {
+	if msg.Type != socketTypeCreateChirp {
+		return &SocketMessage{Type: socketTypeError, Code: errCodeBadRequest, Error: "unknown message type: " + msg.Type}
+	}
+
+	// the socket itself was opened with a GET, so middlewareMaintenance didn't see this write
+	if maintenanceMode(cfg.maintenance.Load()) != maintenanceOff {
+		return &SocketMessage{Type: socketTypeError, Code: errCodeMaintenance, Error: "down for maintenance, please try again later"}
+	}
+
+	// the token was checked when the socket opened, which may have been a while ago
+	if err := cfg.checkSocketSession(req.Context(), info); err != nil {
+		if errors.Is(err, errSessionRevoked) || errors.Is(err, errAccountDeactivated) || errors.Is(err, errSocketTokenExpired) {
+			return &SocketMessage{Type: socketTypeError, Code: errCodeUnauthorized, Error: "Unauthorized"}
+		}
+		logRequestError(req, "error checking account", err, "user_id", info.UserID)
+		return &SocketMessage{Type: socketTypeError, Code: errCodeInternal, Error: "error creating chirp"}
+	}
+
+	userID := info.UserID
+	_, _, err := cfg.saveChirp(req.Context(), userID, CreateChirp{Body: msg.Body}) // the socket is for the public timeline
+	var invalid *chirpInvalidError
+	if errors.As(err, &invalid) {
+		if invalid.length > cfg.maxChirpLength {
+			return &SocketMessage{Type: socketTypeError, Code: errCodeChirpTooLong, Error: cfg.chirpTooLongMessage(), Max: cfg.maxChirpLength, Length: invalid.length}
+		}
+		return &SocketMessage{Type: socketTypeError, Code: errCodeValidation, Error: "body " + invalid.fields["body"]}
+	}
+	var rejected *chirpRejectedError
+	if errors.As(err, &rejected) {
+		return &SocketMessage{Type: socketTypeError, Code: errCodeChirpRejected, Error: rejected.reason}
+	}
+	if err != nil {
+		logRequestError(req, "error creating chirp", err, "user_id", userID)
+		return &SocketMessage{Type: socketTypeError, Code: errCodeInternal, Error: "error creating chirp"}
+	}
+	return nil
+}
+
+var errSocketTokenExpired = errors.New("token expired")
+
+// checkSocketSession re-checks a socket's access token before it writes anything: it may have expired, been
+// revoked, or had its account deactivated since the socket opened.
+func (cfg *apiConfig) checkSocketSession(ctx context.Context, info auth.TokenInfo) error {
+	if !info.ExpiresAt.IsZero() && time.Now().After(info.ExpiresAt) {
+		return errSocketTokenExpired
+	}
+	if cfg.revokedSessions.isRevoked(info.UserID, info.IssuedAt) {
+		return errSessionRevoked
+	}
+	return cfg.checkAccountActive(ctx, info.UserID)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialSocket opens GET /api/ws on server with token in the query string
+func dialSocket(t *testing.T, serverURL, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(serverURL, "http") + "/api/ws"
+	if token != "" {
+		url += "?token=" + token
+	}
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+// readSocketMessage reads one message, failing the test if none arrives in time
+func readSocketMessage(t *testing.T, conn *websocket.Conn) SocketMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg SocketMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("error reading socket message: %v", err)
+	}
+	return msg
+}
+
+func TestChirpSocket(t *testing.T) {
+	db := newMockDB()
+	user, token := createTestUser(t, db, "gus@pollos.com", "chicken")
+	cfg := newTestConfig(db)
+	// wrapped like main() does, since the logging middleware has to let the upgrade hijack the connection
+	server := httptest.NewServer(middlewareRequestID(middlewareLogging(cfg.routes())))
+	defer server.Close()
+
+	_, resp, err := dialSocket(t, server.URL, "")
+	if err == nil || resp == nil || resp.StatusCode != 401 {
+		t.Fatalf("no token: expected a 401, got: %v", resp)
+	}
+
+	conn, _, err := dialSocket(t, server.URL, token)
+	if err != nil {
+		t.Fatalf("error dialing socket: %v", err)
+	}
+	defer conn.Close()
+
+	// wait until the handler has subscribed, so the chirp below isn't published before anyone's listening
+	for i := 0; cfg.chirpHub.Len() == 0; i++ {
+		if i > 100 {
+			t.Fatalf("socket never subscribed to the hub")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// chirps posted over plain HTTP show up on the socket
+	resp = doRequest(t, "POST", server.URL+"/api/chirps", `{"body":"over http"}`, token)
+	resp.Body.Close()
+	msg := readSocketMessage(t, conn)
+	if msg.Type != socketTypeChirp || msg.Chirp == nil || msg.Chirp.Body != "over http" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	// and chirps can be posted over the socket itself
+	if err := conn.WriteJSON(SocketMessage{Type: socketTypeCreateChirp, Body: "over the socket"}); err != nil {
+		t.Fatalf("error writing to socket: %v", err)
+	}
+	msg = readSocketMessage(t, conn)
+	if msg.Type != socketTypeChirp || msg.Chirp == nil || msg.Chirp.Body != "over the socket" || msg.Chirp.UserID != user.ID {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+
+	if err := conn.WriteJSON(SocketMessage{Type: socketTypeCreateChirp, Body: strings.Repeat("a", 141)}); err != nil {
+		t.Fatalf("error writing to socket: %v", err)
+	}
+	msg = readSocketMessage(t, conn)
+	if msg.Type != socketTypeError || msg.Code != errCodeChirpTooLong || msg.Max != 140 || msg.Length != 141 {
+		t.Errorf("expected a chirp_too_long error, got: %+v", msg)
+	}
+
+	// closing cleanly unsubscribes from the hub
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	for i := 0; cfg.chirpHub.Len() != 0; i++ {
+		if i > 100 {
+			t.Fatalf("socket still subscribed after closing")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestChirpSocketChecks(t *testing.T) {
+	db := newMockDB()
+	user, token := createTestUser(t, db, "gus@pollos.com", "chicken")
+	cfg := newTestConfig(db)
+	cfg.chirpDedupeWindow = 10 * time.Second
+	server := httptest.NewServer(middlewareRequestID(middlewareLogging(cfg.routes())))
+	defer server.Close()
+
+	conn, _, err := dialSocket(t, server.URL, token)
+	if err != nil {
+		t.Fatalf("error dialing socket: %v", err)
+	}
+	defer conn.Close()
+	for i := 0; cfg.chirpHub.Len() == 0; i++ {
+		if i > 100 {
+			t.Fatalf("socket never subscribed to the hub")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	send := func(body string) {
+		t.Helper()
+		if err := conn.WriteJSON(SocketMessage{Type: socketTypeCreateChirp, Body: body}); err != nil {
+			t.Fatalf("error writing to socket: %v", err)
+		}
+	}
+
+	// an empty chirp gets the same validation as POST /api/chirps
+	send("  \n ")
+	msg := readSocketMessage(t, conn)
+	if msg.Type != socketTypeError || msg.Code != errCodeValidation {
+		t.Errorf("blank body: expected a %v error, got: %+v", errCodeValidation, msg)
+	}
+
+	// and so does a double-post: the second copy isn't stored, or sent out again
+	send("los pollos hermanos")
+	msg = readSocketMessage(t, conn)
+	if msg.Type != socketTypeChirp || msg.Chirp == nil || msg.Chirp.Body != "los pollos hermanos" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	send("los pollos hermanos")
+	send("") // answered with an error, so once that arrives the duplicate has been handled
+	msg = readSocketMessage(t, conn)
+	if msg.Type != socketTypeError || msg.Code != errCodeValidation {
+		t.Errorf("expected the duplicate to be dropped quietly, got: %+v", msg)
+	}
+	count := 0
+	for _, chirp := range db.chirps {
+		if chirp.UserID == user.ID {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected 1 chirp stored, got: %v", count)
+	}
+
+	// revoking the user's sessions stops an already-open socket from posting
+	cfg.revokedSessions.revoke(user.ID, time.Now())
+	send("still here")
+	msg = readSocketMessage(t, conn)
+	if msg.Type != socketTypeError || msg.Code != errCodeUnauthorized {
+		t.Errorf("revoked session: expected an %v error, got: %+v", errCodeUnauthorized, msg)
+	}
+}